@@ -0,0 +1,29 @@
+package main
+
+import (
+	"embed"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
+)
+
+//go:embed adminui
+var adminUIFiles embed.FS
+
+func adminUIHandler() fiber.Handler {
+	files := filesystem.New(filesystem.Config{
+		Root:       http.FS(adminUIFiles),
+		PathPrefix: "adminui",
+		Index:      "index.html",
+	})
+
+	return func(c *fiber.Ctx) error {
+		// Asset paths in index.html are relative, so the page has to be
+		// served from the directory URL.
+		if c.Path() == "/admin/ui" {
+			return c.Redirect("/admin/ui/", fiber.StatusMovedPermanently)
+		}
+		return files(c)
+	}
+}
@@ -0,0 +1,117 @@
+(function () {
+  var session = JSON.parse(sessionStorage.getItem("library-session") || "null");
+
+  function api(method, path, body) {
+    var headers = { "Content-Type": "application/json" };
+    if (session) {
+      headers["Authorization"] = "Bearer " + session.token;
+    }
+    return fetch(path, {
+      method: method,
+      headers: headers,
+      body: body ? JSON.stringify(body) : undefined,
+    }).then(function (res) {
+      return res.json().then(function (data) {
+        // An expired or revoked token: drop it and go back to the login form.
+        if (res.status === 401 && session) {
+          logout();
+          throw new Error("Oturumunuz sona erdi, lütfen tekrar giriş yapın");
+        }
+        if (!res.ok) {
+          throw new Error(data.error || res.statusText);
+        }
+        return data;
+      });
+    });
+  }
+
+  function notify(text, isError) {
+    var el = document.getElementById("message");
+    el.textContent = text;
+    el.className = isError ? "error" : "";
+    el.style.display = "block";
+    clearTimeout(notify.timer);
+    notify.timer = setTimeout(function () { el.style.display = "none"; }, 4000);
+  }
+
+  function fail(err) {
+    notify(err.message, true);
+  }
+
+  function fillTable(id, rows) {
+    var tbody = document.querySelector("#" + id + " tbody");
+    tbody.innerHTML = "";
+    rows.forEach(function (cells) {
+      var tr = document.createElement("tr");
+      cells.forEach(function (cell) {
+        var td = document.createElement("td");
+        td.textContent = cell == null ? "" : cell;
+        tr.appendChild(td);
+      });
+      tbody.appendChild(tr);
+    });
+  }
+
+  function showDashboard() {
+    document.getElementById("login-panel").hidden = !!session;
+    document.getElementById("dashboard").hidden = !session;
+    document.getElementById("logout").hidden = !session;
+    document.getElementById("session").textContent = session ? session.username + " (" + session.role + ")" : "";
+  }
+
+  function logout() {
+    session = null;
+    sessionStorage.removeItem("library-session");
+    showDashboard();
+  }
+
+  document.getElementById("logout").addEventListener("click", logout);
+
+  document.getElementById("login-form").addEventListener("submit", function (e) {
+    e.preventDefault();
+    var form = e.target;
+    api("POST", "/login", { username: form.username.value, password: form.password.value })
+      .then(function (data) {
+        if (data.role === "patron") {
+          throw new Error("Bu panel yalnızca personel içindir");
+        }
+        session = { user_id: data.user_id, token: data.token, role: data.role, username: form.username.value };
+        sessionStorage.setItem("library-session", JSON.stringify(session));
+        showDashboard();
+      })
+      .catch(fail);
+  });
+
+  document.getElementById("search-form").addEventListener("submit", function (e) {
+    e.preventDefault();
+    api("GET", "/books?q=" + encodeURIComponent(e.target.q.value))
+      .then(function (books) {
+        fillTable("books", (books || []).map(function (b) {
+          return [b.id, b.title, b.borrower_id];
+        }));
+      })
+      .catch(fail);
+  });
+
+  document.getElementById("circulation-form").addEventListener("submit", function (e) {
+    e.preventDefault();
+    var form = e.target;
+    var action = e.submitter ? e.submitter.dataset.action : "/borrow";
+    api("POST", action, { user_id: form.user_id.value, book_id: form.book_id.value })
+      .then(function (data) { notify(data.message); })
+      .catch(fail);
+  });
+
+  document.getElementById("user-form").addEventListener("submit", function (e) {
+    e.preventDefault();
+    api("GET", "/users?q=" + encodeURIComponent(e.target.q.value))
+      .then(function (users) {
+        fillTable("users", users.map(function (u) {
+          return [u.id, u.username, u.role, (u.books || []).join(", ")];
+        }));
+      })
+      .catch(fail);
+  });
+
+  showDashboard();
+})();
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Tags name the collections an aggregation reads. Writes to a collection
+// bust every cached result carrying its tag.
+const (
+	tagLoans = "loans"
+	tagBooks = "books"
+	tagUsers = "users"
+)
+
+type aggCacheEntry struct {
+	value   interface{}
+	expires time.Time
+	tags    []string
+}
+
+// generations counts busts per tag, so a load only has to be discarded
+// when one of its own tags was busted while it ran.
+var aggCache = struct {
+	sync.Mutex
+	entries     map[string]aggCacheEntry
+	generations map[string]uint64
+}{entries: map[string]aggCacheEntry{}, generations: map[string]uint64{}}
+
+var aggLoads singleflight.Group
+
+// cachedAggregate returns the cached result for key, running load at most
+// once across concurrent callers when it is missing or older than ttl.
+func cachedAggregate(key string, ttl time.Duration, tags []string, load func() (interface{}, error)) (interface{}, error) {
+	aggCache.Lock()
+	entry, ok := aggCache.entries[key]
+	aggCache.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	v, err, _ := aggLoads.Do(key, func() (interface{}, error) {
+		aggCache.Lock()
+		generations := make([]uint64, len(tags))
+		for i, t := range tags {
+			generations[i] = aggCache.generations[t]
+		}
+		aggCache.Unlock()
+
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		aggCache.Lock()
+		defer aggCache.Unlock()
+		// A bust of one of our tags during the load may have made this
+		// result stale already.
+		for i, t := range tags {
+			if aggCache.generations[t] != generations[i] {
+				return value, nil
+			}
+		}
+		now := time.Now()
+		for k, e := range aggCache.entries {
+			if !now.Before(e.expires) {
+				delete(aggCache.entries, k)
+			}
+		}
+		aggCache.entries[key] = aggCacheEntry{value: value, expires: now.Add(ttl), tags: tags}
+		return value, nil
+	})
+	return v, err
+}
+
+func bustAggregates(tags ...string) {
+	aggCache.Lock()
+	defer aggCache.Unlock()
+
+	for _, t := range tags {
+		aggCache.generations[t]++
+	}
+	for key, entry := range aggCache.entries {
+		for _, t := range entry.tags {
+			if containsString(tags, t) {
+				delete(aggCache.entries, key)
+				break
+			}
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCachedAggregateBustsPerTag(t *testing.T) {
+	loads := 0
+	load := func(bust string) func() (interface{}, error) {
+		return func() (interface{}, error) {
+			loads++
+			if bust != "" {
+				bustAggregates(bust)
+			}
+			return loads, nil
+		}
+	}
+
+	// A bust of an unrelated tag during the load keeps the result.
+	cachedAggregate("test:unrelated", time.Minute, []string{tagLoans}, load(tagBooks))
+	if v, _ := cachedAggregate("test:unrelated", time.Minute, []string{tagLoans}, load("")); v != 1 {
+		t.Errorf("unrelated bust discarded the result: got load %v", v)
+	}
+
+	// A bust of its own tag during the load discards it.
+	cachedAggregate("test:own", time.Minute, []string{tagLoans}, load(tagLoans))
+	if v, _ := cachedAggregate("test:own", time.Minute, []string{tagLoans}, load("")); v != 3 {
+		t.Errorf("stale result was cached: got load %v", v)
+	}
+
+	bustAggregates(tagLoans)
+	if v, _ := cachedAggregate("test:own", time.Minute, []string{tagLoans}, load("")); v != 4 {
+		t.Errorf("bust did not evict: got load %v", v)
+	}
+}
+
+func TestCachedReportKeyIncludesRunTime(t *testing.T) {
+	runs := []time.Time{}
+	reportGenerators["test"] = func(_ context.Context, now time.Time) ([][]string, error) {
+		runs = append(runs, now)
+		return [][]string{{now.Format(time.RFC3339)}}, nil
+	}
+	reportCacheTTL["test"] = time.Hour
+	defer delete(reportGenerators, "test")
+	defer delete(reportCacheTTL, "test")
+
+	first := time.Date(2026, 3, 9, 8, 0, 10, 0, time.UTC)
+	cachedReport(context.Background(), "test", first)
+	cachedReport(context.Background(), "test", first.Add(20*time.Second))
+	cachedReport(context.Background(), "test", first.Add(7*24*time.Hour))
+
+	if len(runs) != 2 {
+		t.Fatalf("generator ran %d times, want 2 (shared within the minute, fresh a week later)", len(runs))
+	}
+}
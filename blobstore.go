@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errBlobNotFound = errors.New("dosya bulunamadı")
+
+type Blob struct {
+	Data        []byte
+	ContentType string
+	ModTime     time.Time
+}
+
+// BlobStore keeps file assets such as covers, photos and exports under
+// slash-separated keys, e.g. "exports/books-2025-01-31.csv".
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (*Blob, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type StorageConfig struct {
+	Driver   string `json:"driver"`
+	Path     string `json:"path"`
+	Bucket   string `json:"bucket"`
+	Region   string `json:"region"`
+	Endpoint string `json:"endpoint"`
+	Prefix   string `json:"prefix"`
+}
+
+var blobStore BlobStore
+
+func newBlobStore(cfg StorageConfig, db *mongo.Database) (BlobStore, error) {
+	switch cfg.Driver {
+	case "", "local":
+		root := cfg.Path
+		if root == "" {
+			root = "data"
+		}
+		return &localBlobStore{root: root}, nil
+	case "gridfs":
+		bucket := cfg.Bucket
+		if bucket == "" {
+			bucket = "files"
+		}
+		return &gridFSBlobStore{db: db, bucket: bucket}, nil
+	case "s3":
+		return newS3BlobStore(cfg)
+	}
+	return nil, fmt.Errorf("bilinmeyen depolama sürücüsü: %s", cfg.Driver)
+}
+
+// validBlobKey rejects keys that could escape the store's root: absolute
+// paths, ".." segments, and backslashes, which are separators on Windows.
+func validBlobKey(key string) bool {
+	if key == "" || key == "." || key == ".." || path.Clean(key) != key {
+		return false
+	}
+	if strings.ContainsRune(key, '\\') {
+		return false
+	}
+	return !strings.HasPrefix(key, "/") && !strings.HasPrefix(key, "../")
+}
+
+// localBlobStore keeps each blob's content type in a sidecar file next to
+// it, so it behaves like the GridFS and S3 drivers.
+type localBlobStore struct {
+	root string
+}
+
+const localContentTypeSuffix = ".content-type"
+
+func (s *localBlobStore) path(key string) (string, error) {
+	if !validBlobKey(key) || strings.HasSuffix(key, localContentTypeSuffix) {
+		return "", fmt.Errorf("geçersiz dosya anahtarı: %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *localBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(p, data, 0o644); err != nil {
+		return err
+	}
+	if contentType == "" {
+		if err := os.Remove(p + localContentTypeSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(p+localContentTypeSuffix, []byte(contentType), 0o644)
+}
+
+func (s *localBlobStore) Get(ctx context.Context, key string) (*Blob, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files written without a content type, or before it was stored, fall
+	// back to a guess from the extension.
+	var contentType string
+	if ct, err := os.ReadFile(p + localContentTypeSuffix); err == nil {
+		contentType = string(ct)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(p))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &Blob{Data: data, ContentType: contentType, ModTime: info.ModTime()}, nil
+}
+
+func (s *localBlobStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{p, p + localContentTypeSuffix} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+type gridFSBlobStore struct {
+	db     *mongo.Database
+	bucket string
+}
+
+// open returns a bucket bound to ctx's deadline. Deadlines are per bucket,
+// so one is created for each operation.
+func (s *gridFSBlobStore) open(ctx context.Context) (*gridfs.Bucket, error) {
+	b, err := gridfs.NewBucket(s.db, options.GridFSBucket().SetName(s.bucket))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		b.SetReadDeadline(deadline)
+		b.SetWriteDeadline(deadline)
+	}
+	return b, nil
+}
+
+func (s *gridFSBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if !validBlobKey(key) {
+		return fmt.Errorf("geçersiz dosya anahtarı: %q", key)
+	}
+	b, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts := options.GridFSUpload().SetMetadata(bson.M{"content_type": contentType})
+	if _, err := b.UploadFromStream(key, bytes.NewReader(data), opts); err != nil {
+		return err
+	}
+	return s.deleteRevisions(ctx, b, key, 1)
+}
+
+// deleteRevisions removes all uploads of key except the newest keep ones.
+func (s *gridFSBlobStore) deleteRevisions(ctx context.Context, b *gridfs.Bucket, key string, keep int32) error {
+	cursor, err := b.FindContext(ctx, bson.M{"filename": key}, options.GridFSFind().SetSort(bson.M{"uploadDate": -1}).SetSkip(keep))
+	if err != nil {
+		return err
+	}
+	var files []struct {
+		ID interface{} `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &files); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := b.DeleteContext(ctx, f.ID); err != nil && err != gridfs.ErrFileNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *gridFSBlobStore) Get(ctx context.Context, key string) (*Blob, error) {
+	b, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := b.OpenDownloadStreamByName(key)
+	if err == gridfs.ErrFileNotFound {
+		return nil, errBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	file := stream.GetFile()
+	var meta struct {
+		ContentType string `bson:"content_type"`
+	}
+	if file.Metadata != nil {
+		bson.Unmarshal(file.Metadata, &meta)
+	}
+	if meta.ContentType == "" {
+		meta.ContentType = "application/octet-stream"
+	}
+	return &Blob{Data: data, ContentType: meta.ContentType, ModTime: file.UploadDate}, nil
+}
+
+func (s *gridFSBlobStore) Delete(ctx context.Context, key string) error {
+	b, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+	return s.deleteRevisions(ctx, b, key, 0)
+}
+
+type s3BlobStore struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// newS3BlobStore uses the standard AWS credential chain (environment,
+// shared config, instance role). Endpoint allows S3-compatible services.
+func newS3BlobStore(cfg StorageConfig) (*s3BlobStore, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 için bucket zorunlu")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return &s3BlobStore{client: client, bucket: cfg.Bucket, prefix: cfg.Prefix}, nil
+}
+
+func (s *s3BlobStore) objectKey(key string) (*string, error) {
+	if !validBlobKey(key) {
+		return nil, fmt.Errorf("geçersiz dosya anahtarı: %q", key)
+	}
+	return aws.String(path.Join(s.prefix, key)), nil
+}
+
+func (s *s3BlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	objectKey, err := s.objectKey(key)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         objectKey,
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+func (s *s3BlobStore) Get(ctx context.Context, key string) (*Blob, error) {
+	objectKey, err := s.objectKey(key)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    objectKey,
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, errBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := &Blob{Data: data, ContentType: aws.ToString(out.ContentType)}
+	if out.LastModified != nil {
+		blob.ModTime = *out.LastModified
+	}
+	return blob, nil
+}
+
+func (s *s3BlobStore) Delete(ctx context.Context, key string) error {
+	objectKey, err := s.objectKey(key)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    objectKey,
+	})
+	return err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidBlobKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"photos/abc.png", true},
+		{"exports/books-2025-01-31.csv", true},
+		{"cover.jpg", true},
+		{"a/.hidden", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../etc/passwd", false},
+		{"a/../../etc/passwd", false},
+		{"a/../b", false},
+		{"/etc/passwd", false},
+		{"a//b", false},
+		{"a/./b", false},
+		{"a/", false},
+		{`..\..\windows\win.ini`, false},
+		{`photos\abc.png`, false},
+	}
+
+	for _, tt := range tests {
+		if got := validBlobKey(tt.key); got != tt.want {
+			t.Errorf("validBlobKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	s := &localBlobStore{root: root}
+
+	if _, err := s.Get(ctx, "photos/missing.png"); !errors.Is(err, errBlobNotFound) {
+		t.Fatalf("Get missing: %v, want errBlobNotFound", err)
+	}
+
+	if err := s.Put(ctx, "exports/report", []byte("a,b\n"), "text/csv; charset=utf-8"); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := s.Get(ctx, "exports/report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(blob.Data) != "a,b\n" || blob.ContentType != "text/csv; charset=utf-8" || blob.ModTime.IsZero() {
+		t.Errorf("Get = %q %q %v", blob.Data, blob.ContentType, blob.ModTime)
+	}
+
+	// Overwriting without a content type drops the stored one.
+	if err := s.Put(ctx, "exports/report", []byte("x"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if blob, err = s.Get(ctx, "exports/report"); err != nil || blob.ContentType != "application/octet-stream" {
+		t.Errorf("Get after overwrite = %v, %v", blob, err)
+	}
+
+	// Files without a sidecar fall back to the extension.
+	if err := os.WriteFile(filepath.Join(root, "cover.png"), []byte("png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if blob, err = s.Get(ctx, "cover.png"); err != nil || blob.ContentType != "image/png" {
+		t.Errorf("Get without sidecar = %v, %v", blob, err)
+	}
+
+	if err := s.Put(ctx, "photos/a.png", []byte("png"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "photos/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "photos", "a.png"+localContentTypeSuffix)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("sidecar left behind: %v", err)
+	}
+	if err := s.Delete(ctx, "photos/a.png"); err != nil {
+		t.Errorf("Delete missing: %v", err)
+	}
+
+	for _, key := range []string{"../escape", "/tmp/escape", "a/../../escape", "photos/a.png" + localContentTypeSuffix} {
+		if err := s.Put(ctx, key, []byte("x"), ""); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if _, err := s.Get(ctx, key); err == nil || errors.Is(err, errBlobNotFound) {
+			t.Errorf("Get(%q) = %v, want invalid key error", key, err)
+		}
+		if err := s.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) succeeded", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "escape")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("a key escaped the store root")
+	}
+}
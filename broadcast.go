@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// broadcastInterval throttles delivery so a large segment does not flood
+// the SMTP server.
+const broadcastInterval = 200 * time.Millisecond
+
+// maxStoredFailures bounds the failures list kept on a broadcast; the
+// failed counter still counts every one.
+const maxStoredFailures = 100
+
+type Segment struct {
+	Role       Role   `bson:"role,omitempty" json:"role,omitempty"`
+	HasOverdue *bool  `bson:"has_overdue,omitempty" json:"has_overdue,omitempty"`
+	Branch     string `bson:"-" json:"branch,omitempty"`
+	Tier       string `bson:"-" json:"membership_tier,omitempty"`
+}
+
+type DeliveryFailure struct {
+	UserID primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Error  string             `bson:"error" json:"error"`
+}
+
+type Broadcast struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Subject    string             `bson:"subject" json:"subject"`
+	Message    string             `bson:"message" json:"message"`
+	Channel    string             `bson:"channel" json:"channel"`
+	Segment    Segment            `bson:"segment" json:"segment"`
+	CreatedBy  primitive.ObjectID `bson:"created_by" json:"created_by"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	FinishedAt *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	Status     string             `bson:"status" json:"status"`
+	Total      int                `bson:"total" json:"total"`
+	Sent       int                `bson:"sent" json:"sent"`
+	Skipped    int                `bson:"skipped" json:"skipped"`
+	Failed     int                `bson:"failed" json:"failed"`
+	Failures   []DeliveryFailure  `bson:"failures" json:"failures"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+func segmentFilter(ctx context.Context, s Segment) (bson.M, error) {
+	filter := bson.M{}
+	if s.Role != "" {
+		if s.Role == RolePatron {
+			filter["role"] = bson.M{"$in": []interface{}{RolePatron, nil}}
+		} else {
+			filter["role"] = s.Role
+		}
+	}
+	if s.HasOverdue != nil {
+		ids, err := loanCollection.Distinct(ctx, "user_id", bson.M{
+			"returned_at": bson.M{"$exists": false},
+			"due_at":      bson.M{"$lt": time.Now()},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if *s.HasOverdue {
+			filter["_id"] = bson.M{"$in": ids}
+		} else {
+			filter["_id"] = bson.M{"$nin": ids}
+		}
+	}
+	return filter, nil
+}
+
+func createBroadcast(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageUsers) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	type request struct {
+		Subject string  `json:"subject"`
+		Message string  `json:"message"`
+		Channel string  `json:"channel"`
+		Segment Segment `json:"segment"`
+	}
+	var body request
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz JSON"})
+	}
+	if body.Subject == "" || body.Message == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "subject ve message zorunlu"})
+	}
+	if body.Channel == "" {
+		body.Channel = "email"
+	}
+	if body.Channel != "email" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Yalnızca email kanalı destekleniyor"})
+	}
+	if body.Segment.Branch != "" || body.Segment.Tier != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Şube ve üyelik seviyesine göre filtreleme desteklenmiyor"})
+	}
+	if body.Segment.Role != "" && !body.Segment.Role.valid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz rol"})
+	}
+	if !mailConfigured() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "E-posta sunucusu yapılandırılmamış (SMTP_HOST)"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter, err := segmentFilter(ctx, body.Segment)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Veritabanı hatası"})
+	}
+	total, err := userCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Veritabanı hatası"})
+	}
+
+	b := Broadcast{
+		Subject:   body.Subject,
+		Message:   body.Message,
+		Channel:   body.Channel,
+		Segment:   body.Segment,
+		CreatedBy: currentActor(c).ID,
+		CreatedAt: time.Now(),
+		Status:    "queued",
+		Total:     int(total),
+		Failures:  []DeliveryFailure{},
+	}
+
+	res, err := broadcastCollection.InsertOne(ctx, b)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Duyuru oluşturulamadı"})
+	}
+	b.ID = res.InsertedID.(primitive.ObjectID)
+
+	go deliverBroadcast(b, filter)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"id": b.ID, "total": b.Total})
+}
+
+func deliverBroadcast(b Broadcast, filter bson.M) {
+	ctx := context.Background()
+
+	cursor, err := userCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"email": 1}))
+	if err != nil {
+		log.Printf("Duyuru alıcıları alınamadı (%s): %v", b.ID.Hex(), err)
+		finishBroadcast(ctx, b.ID, "failed", "Alıcılar alınamadı")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	broadcastCollection.UpdateOne(ctx, bson.M{"_id": b.ID}, bson.M{"$set": bson.M{"status": "sending"}})
+
+	ticker := time.NewTicker(broadcastInterval)
+	defer ticker.Stop()
+
+	for cursor.Next(ctx) {
+		var user User
+		if err := cursor.Decode(&user); err != nil {
+			continue
+		}
+
+		update := bson.M{"$inc": bson.M{"skipped": 1}}
+		if user.Email != "" {
+			<-ticker.C
+			if err := sendMail([]string{user.Email}, b.Subject, b.Message); err != nil {
+				update = bson.M{
+					"$inc": bson.M{"failed": 1},
+					"$push": bson.M{"failures": bson.M{
+						"$each":  []DeliveryFailure{{UserID: user.ID, Error: err.Error()}},
+						"$slice": -maxStoredFailures,
+					}},
+				}
+			} else {
+				update = bson.M{"$inc": bson.M{"sent": 1}}
+			}
+		}
+		if _, err := broadcastCollection.UpdateOne(ctx, bson.M{"_id": b.ID}, update); err != nil {
+			log.Printf("Duyuru raporu güncellenemedi (%s): %v", b.ID.Hex(), err)
+		}
+	}
+
+	finishBroadcast(ctx, b.ID, "done", "")
+}
+
+func finishBroadcast(ctx context.Context, id primitive.ObjectID, status, reason string) {
+	set := bson.M{"status": status, "finished_at": time.Now()}
+	if reason != "" {
+		set["error"] = reason
+	}
+	_, err := broadcastCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	if err != nil {
+		log.Printf("Duyuru durumu güncellenemedi (%s): %v", id.Hex(), err)
+	}
+}
+
+// failInterruptedBroadcasts marks broadcasts left queued or sending by a
+// previous process as failed; delivery is not resumed.
+func failInterruptedBroadcasts() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := broadcastCollection.UpdateMany(ctx,
+		bson.M{"status": bson.M{"$in": []string{"queued", "sending"}}},
+		bson.M{"$set": bson.M{"status": "failed", "finished_at": time.Now(), "error": "Gönderim sunucu yeniden başlatılırken yarıda kaldı"}},
+	)
+	if err != nil {
+		log.Println("Yarım kalan duyurular güncellenemedi:", err)
+		return
+	}
+	if res.ModifiedCount > 0 {
+		log.Printf("%d yarım kalan duyuru başarısız olarak işaretlendi", res.ModifiedCount)
+	}
+}
+
+func getBroadcast(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageUsers) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz duyuru ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var b Broadcast
+	if err := broadcastCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&b); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Duyuru bulunamadı"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(b)
+}
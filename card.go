@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"time"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/qr"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	maxPhotoBytes  = 5 << 20
+	minPhotoSide   = 200
+	maxPhotoSide   = 6000
+	photoWidth     = 300
+	photoHeight    = 400
+	cardWidth      = 1012
+	cardHeight     = 638
+	cardCacheRules = "private, max-age=300"
+)
+
+var (
+	cardTitleFace font.Face
+	cardTextFace  font.Face
+)
+
+func init() {
+	cardTitleFace = mustFace(gobold.TTF, 44)
+	cardTextFace = mustFace(goregular.TTF, 26)
+}
+
+func mustFace(ttf []byte, size float64) font.Face {
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		panic(err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		panic(err)
+	}
+	return face
+}
+
+func photoKey(userID primitive.ObjectID) string {
+	return "photos/" + userID.Hex() + ".jpg"
+}
+
+// fitPhoto center-crops src to the card photo aspect ratio and scales it
+// to photoWidth x photoHeight.
+func fitPhoto(src image.Image) image.Image {
+	b := src.Bounds()
+	crop := b
+	if b.Dx()*photoHeight > b.Dy()*photoWidth {
+		w := b.Dy() * photoWidth / photoHeight
+		crop.Min.X = b.Min.X + (b.Dx()-w)/2
+		crop.Max.X = crop.Min.X + w
+	} else {
+		h := b.Dx() * photoHeight / photoWidth
+		crop.Min.Y = b.Min.Y + (b.Dy()-h)/2
+		crop.Max.Y = crop.Min.Y + h
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, photoWidth, photoHeight))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+	return dst
+}
+
+func uploadPhoto(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz kullanıcı ID"})
+	}
+	if !authorize(c, objID, PermManageUsers) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	fh, err := c.FormFile("photo")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "photo dosyası zorunlu"})
+	}
+	if fh.Size > maxPhotoBytes {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "Fotoğraf en fazla 5 MB olabilir"})
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Fotoğraf okunamadı"})
+	}
+	defer f.Close()
+
+	// Check the declared size before decoding; a tiny file can claim
+	// dimensions that would need gigabytes to decode.
+	cfg, _, err := image.DecodeConfig(io.LimitReader(f, maxPhotoBytes))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Fotoğraf JPEG veya PNG olmalı"})
+	}
+	if cfg.Width < minPhotoSide || cfg.Height < minPhotoSide {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Fotoğraf en az 200x200 piksel olmalı"})
+	}
+	if cfg.Width > maxPhotoSide || cfg.Height > maxPhotoSide {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Fotoğraf en fazla 6000x6000 piksel olabilir"})
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Fotoğraf okunamadı"})
+	}
+
+	src, _, err := image.Decode(io.LimitReader(f, maxPhotoBytes))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Fotoğraf JPEG veya PNG olmalı"})
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, fitPhoto(src), &jpeg.Options{Quality: 90}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Fotoğraf işlenemedi"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	count, err := userCollection.CountDocuments(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Veritabanı hatası"})
+	}
+	if count == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kullanıcı bulunamadı"})
+	}
+
+	if err := blobStore.Put(ctx, photoKey(objID), buf.Bytes(), "image/jpeg"); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Fotoğraf kaydedilemedi"})
+	}
+	_, err = userCollection.UpdateOne(ctx,
+		bson.M{"_id": objID},
+		bson.M{"$set": bson.M{"photo_updated_at": time.Now()}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kullanıcı güncellenemedi"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Fotoğraf yüklendi"})
+}
+
+func userCard(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz kullanıcı ID"})
+	}
+	if !authorize(c, objID, PermViewCurrentLoans) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kullanıcı bulunamadı"})
+	}
+
+	var photo image.Image
+	if user.PhotoUpdatedAt != nil {
+		blob, err := blobStore.Get(ctx, photoKey(objID))
+		if err != nil && err != errBlobNotFound {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Fotoğraf alınamadı"})
+		}
+		if blob != nil {
+			photo, _, _ = image.Decode(bytes.NewReader(blob.Data))
+		}
+	}
+
+	data, err := renderCard(&user, photo)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kart oluşturulamadı"})
+	}
+
+	var modTime time.Time
+	if user.PhotoUpdatedAt != nil {
+		modTime = *user.PhotoUpdatedAt
+	}
+	return sendCacheable(c, data, "image/png", modTime, cardCacheRules)
+}
+
+// renderCard draws a CR80-proportioned library card with the patron's
+// photo, name, a Code 128 barcode and a QR code of their card number.
+func renderCard(user *User, photo image.Image) ([]byte, error) {
+	cardNumber := user.ID.Hex()
+
+	card := image.NewRGBA(image.Rect(0, 0, cardWidth, cardHeight))
+	draw.Draw(card, card.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(card, image.Rect(0, 0, cardWidth, 90), image.NewUniform(color.RGBA{0x1d, 0x3f, 0x72, 0xff}), image.Point{}, draw.Src)
+
+	drawText(card, cardTitleFace, color.White, 40, 62, "Kütüphane Kartı")
+
+	photoRect := image.Rect(40, 130, 40+photoWidth*3/4, 130+photoHeight*3/4)
+	if photo != nil {
+		draw.CatmullRom.Scale(card, photoRect, photo, photo.Bounds(), draw.Src, nil)
+	} else {
+		draw.Draw(card, photoRect, image.NewUniform(color.RGBA{0xdd, 0xdd, 0xdd, 0xff}), image.Point{}, draw.Src)
+	}
+
+	drawText(card, cardTitleFace, color.Black, 300, 180, user.Username)
+	drawText(card, cardTextFace, color.RGBA{0x55, 0x55, 0x55, 0xff}, 300, 225, "Kart No: "+cardNumber)
+
+	encoded, err := code128.Encode(cardNumber)
+	if err != nil {
+		return nil, err
+	}
+	bar, err := barcode.Scale(encoded, 640, 110)
+	if err != nil {
+		return nil, err
+	}
+	draw.Draw(card, image.Rect(300, 490, 940, 600), bar, image.Point{}, draw.Src)
+
+	code, err := qr.Encode(cardNumber, qr.M, qr.Auto)
+	if err != nil {
+		return nil, err
+	}
+	code, err = barcode.Scale(code, 180, 180)
+	if err != nil {
+		return nil, err
+	}
+	draw.Draw(card, image.Rect(792, 270, 972, 450), code, image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, card); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func drawText(dst draw.Image, face font.Face, col color.Color, x, y int, text string) {
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(col),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const usage = `Kullanım: library-api <komut> [bayraklar]
+
+Komutlar:
+  serve         HTTP sunucusunu başlatır (varsayılan)
+  migrate       İndeksleri oluşturur ve eski kayıtları günceller
+  seed          Boş veritabanına örnek kitaplar ekler
+  create-admin  Yönetici hesabı oluşturur ya da mevcut kullanıcıyı yönetici yapar
+  export        Bir koleksiyonu JSON veya CSV olarak dışa aktarır
+  check         Kullanıcı/kitap/ödünç tutarlılığını denetler, -apply ile onarır
+
+Her komutun bayrakları için: library-api <komut> -h
+`
+
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	configPath := fs.String("config", "", "JSON yapılandırma dosyası")
+	return fs, configPath
+}
+
+// setup loads the config and connects to MongoDB, exiting on failure.
+func setup(configPath string) Config {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		log.Fatal("Yapılandırma okunamadı:", err)
+	}
+	client := connectDB(cfg.MongoURI)
+	db := client.Database(cfg.Database)
+	initCollections(db)
+
+	blobStore, err = newBlobStore(cfg.Storage, db)
+	if err != nil {
+		log.Fatal("Dosya deposu hazırlanamadı:", err)
+	}
+	sessionSecret = []byte(cfg.SessionSecret)
+	if len(sessionSecret) == 0 {
+		log.Println("session_secret tanımlı değil, rastgele anahtar kullanılıyor; oturumlar yeniden başlatmada sona erer")
+		sessionSecret = randomSessionSecret()
+	}
+	if cfg.ProxyHeader != "" && len(cfg.TrustedProxies) == 0 {
+		log.Println("proxy_header tanımlı ama trusted_proxies boş; istemci adresi başlıktan okunmaz")
+	}
+	retentionPolicy = cfg.Retention
+	federation = cfg.Federation
+	for _, p := range federation.Peers {
+		if p.InboundKey == "" {
+			log.Printf("%s için inbound_key tanımlı değil, bu kütüphaneden ödünç talebi alınmaz", p.Name)
+		}
+	}
+	return cfg
+}
+
+func serveCommand(args []string) {
+	fs, configPath := newFlagSet("serve")
+	port := fs.Int("port", 0, "dinlenecek port (yapılandırmadakini geçersiz kılar)")
+	fs.Parse(args)
+
+	cfg := setup(*configPath)
+	if *port != 0 {
+		cfg.Port = *port
+	}
+	serve(cfg)
+}
+
+func migrateCommand(args []string) {
+	fs, configPath := newFlagSet("migrate")
+	fs.Parse(args)
+	setup(*configPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	indexes := []struct {
+		collection *mongo.Collection
+		model      mongo.IndexModel
+	}{
+		{userCollection, mongo.IndexModel{Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetUnique(true)}},
+		{bookCollection, mongo.IndexModel{Keys: bson.D{{Key: "borrower_id", Value: 1}}}},
+		{bookCollection, mongo.IndexModel{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)}},
+		{bookCollection, mongo.IndexModel{Keys: bson.D{{Key: "previous_slugs", Value: 1}}}},
+		{floorMapCollection, mongo.IndexModel{Keys: bson.D{{Key: "branch", Value: 1}, {Key: "floor", Value: 1}}, Options: options.Index().SetUnique(true)}},
+		{loanCollection, mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "borrowed_at", Value: -1}}}},
+		{loanCollection, mongo.IndexModel{Keys: bson.D{{Key: "due_at", Value: 1}}}},
+		{reportSubscriptionCollection, mongo.IndexModel{Keys: bson.D{{Key: "next_run_at", Value: 1}}}},
+	}
+	for _, idx := range indexes {
+		name, err := idx.collection.Indexes().CreateOne(ctx, idx.model)
+		if err != nil {
+			log.Fatalf("İndeks oluşturulamadı (%s): %v", idx.collection.Name(), err)
+		}
+		log.Printf("İndeks hazır: %s.%s", idx.collection.Name(), name)
+	}
+
+	res, err := userCollection.UpdateMany(ctx,
+		bson.M{"role": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"role": RolePatron}},
+	)
+	if err != nil {
+		log.Fatal("Kullanıcı rolleri güncellenemedi:", err)
+	}
+	log.Printf("%d kullanıcıya patron rolü atandı", res.ModifiedCount)
+
+	// Activity was not tracked before the retention policy; start every
+	// existing account's clock now instead of at its creation time.
+	res, err = userCollection.UpdateMany(ctx,
+		bson.M{"last_active_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"last_active_at": time.Now()}},
+	)
+	if err != nil {
+		log.Fatal("Kullanıcı etkinlik tarihleri güncellenemedi:", err)
+	}
+	log.Printf("%d kullanıcıya etkinlik tarihi atandı", res.ModifiedCount)
+
+	cursor, err := bookCollection.Find(ctx, bson.M{"slug": bson.M{"$exists": false}})
+	if err != nil {
+		log.Fatal("Kitaplar alınamadı:", err)
+	}
+	var books []Book
+	if err := cursor.All(ctx, &books); err != nil {
+		log.Fatal("Kitaplar parse edilemedi:", err)
+	}
+	for _, book := range books {
+		slug, err := uniqueSlug(ctx, book.Title, book.ID)
+		if err != nil {
+			log.Fatal("Slug oluşturulamadı:", err)
+		}
+		if _, err := bookCollection.UpdateOne(ctx, bson.M{"_id": book.ID}, bson.M{"$set": bson.M{"slug": slug}}); err != nil {
+			log.Fatal("Kitap güncellenemedi:", err)
+		}
+	}
+	log.Printf("%d kitaba slug atandı", len(books))
+}
+
+var seedBooks = []string{
+	"Suç ve Ceza",
+	"Kürk Mantolu Madonna",
+	"Tutunamayanlar",
+	"İnce Memed",
+	"Saatleri Ayarlama Enstitüsü",
+	"1984",
+	"Dune",
+	"The Hobbit",
+}
+
+func seedCommand(args []string) {
+	fs, configPath := newFlagSet("seed")
+	fs.Parse(args)
+	setup(*configPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	count, err := bookCollection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		log.Fatal("Veritabanı hatası:", err)
+	}
+	if count > 0 {
+		log.Printf("Kitap koleksiyonu boş değil (%d kitap), örnek veri eklenmedi", count)
+		return
+	}
+
+	for _, title := range seedBooks {
+		slug, err := uniqueSlug(ctx, title, primitive.NilObjectID)
+		if err != nil {
+			log.Fatal("Slug oluşturulamadı:", err)
+		}
+		book := Book{Title: title, Slug: slug, Language: defaultCatalogLanguage}
+		if _, err := bookCollection.InsertOne(ctx, book); err != nil {
+			log.Fatal("Örnek kitap eklenemedi:", err)
+		}
+	}
+	log.Printf("%d örnek kitap eklendi", len(seedBooks))
+}
+
+func createAdminCommand(args []string) {
+	fs, configPath := newFlagSet("create-admin")
+	username := fs.String("username", "", "yönetici kullanıcı adı")
+	passwordStdin := fs.Bool("password-stdin", false, "şifreyi standart girdinin ilk satırından oku (yeni hesap için zorunlu, mevcut hesapta verilirse değiştirilir)")
+	fs.Parse(args)
+	if *username == "" {
+		log.Fatal("-username zorunlu")
+	}
+
+	// The password never comes from a flag, so it stays out of shell
+	// history and the process list.
+	password := os.Getenv("LIBRARY_ADMIN_PASSWORD")
+	if *passwordStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			log.Fatal("Şifre okunamadı:", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+		if password == "" {
+			log.Fatal("Standart girdiden boş şifre okundu")
+		}
+	}
+	setup(*configPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	set := bson.M{"role": RoleAdmin}
+	if password != "" {
+		hashed, err := hashPassword(password)
+		if err != nil {
+			log.Fatal("Şifre hashlenemedi:", err)
+		}
+		set["password"] = hashed
+	}
+
+	res, err := userCollection.UpdateOne(ctx, bson.M{"username": *username}, bson.M{"$set": set})
+	if err != nil {
+		log.Fatal("Kullanıcı güncellenemedi:", err)
+	}
+	if res.MatchedCount > 0 {
+		log.Printf("%s yönetici yapıldı", *username)
+		return
+	}
+
+	if password == "" {
+		log.Fatal("Yeni hesap için -password-stdin ya da LIBRARY_ADMIN_PASSWORD ile şifre verilmeli")
+	}
+	user := User{
+		Username: *username,
+		Password: set["password"].(string),
+		Books:    []primitive.ObjectID{},
+		Role:     RoleAdmin,
+	}
+	if _, err := userCollection.InsertOne(ctx, user); err != nil {
+		log.Fatal("Kullanıcı eklenemedi:", err)
+	}
+	log.Printf("Yönetici hesabı oluşturuldu: %s", *username)
+}
+
+func checkCommand(args []string) {
+	fs, configPath := newFlagSet("check")
+	apply := fs.Bool("apply", false, "bulunan tutarsızlıkları onar (varsayılan: yalnızca raporla)")
+	fs.Parse(args)
+	setup(*configPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	report, err := checkConsistency(ctx, !*apply)
+	if err != nil {
+		log.Fatal("Tutarlılık kontrolü yapılamadı:", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+}
+
+func exportCommand(args []string) {
+	fs, configPath := newFlagSet("export")
+	name := fs.String("collection", "books", "books, users veya loans")
+	format := fs.String("format", "json", "json veya csv")
+	out := fs.String("out", "", "çıktı dosyası (varsayılan: standart çıktı)")
+	store := fs.Bool("store", false, "çıktıyı yapılandırılmış dosya deposuna exports/ altında kaydet")
+	fs.Parse(args)
+	setup(*configPath)
+
+	collections := map[string]*mongo.Collection{
+		"books": bookCollection,
+		"users": userCollection,
+		"loans": loanCollection,
+	}
+	coll, ok := collections[*name]
+	if !ok {
+		log.Fatalf("Bilinmeyen koleksiyon: %s", *name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"password": 0}))
+	if err != nil {
+		log.Fatal("Kayıtlar alınamadı:", err)
+	}
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		log.Fatal("Kayıtlar parse edilemedi:", err)
+	}
+
+	var buf bytes.Buffer
+	var w io.Writer = os.Stdout
+	switch {
+	case *store:
+		w = &buf
+	case *out != "":
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal("Çıktı dosyası açılamadı:", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	contentType := "application/json"
+	switch *format {
+	case "json":
+		err = writeJSONExport(w, docs)
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+		err = writeCSVExport(w, docs)
+	default:
+		log.Fatalf("Bilinmeyen format: %s", *format)
+	}
+	if err != nil {
+		log.Fatal("Dışa aktarılamadı:", err)
+	}
+
+	if *store {
+		key := "exports/" + *name + "-" + time.Now().Format("20060102-150405") + "." + *format
+		if err := blobStore.Put(ctx, key, buf.Bytes(), contentType); err != nil {
+			log.Fatal("Dışa aktarım kaydedilemedi:", err)
+		}
+		log.Printf("Dışa aktarım kaydedildi: %s", key)
+	}
+}
+
+func writeJSONExport(w io.Writer, docs []bson.M) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if docs == nil {
+		docs = []bson.M{}
+	}
+	return enc.Encode(docs)
+}
+
+func writeCSVExport(w io.Writer, docs []bson.M) error {
+	seen := map[string]bool{}
+	var columns []string
+	for _, doc := range docs {
+		for key := range doc {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	sort.Strings(columns)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		row := make([]string, len(columns))
+		for i, key := range columns {
+			row[i] = exportValue(doc[key])
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.DateTime:
+		return v.Time().UTC().Format(time.RFC3339)
+	case string:
+		return v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
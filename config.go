@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+type Config struct {
+	MongoURI string `json:"mongo_uri"`
+	Database string `json:"database"`
+	Port     int    `json:"port"`
+
+	SessionSecret string `json:"session_secret"`
+
+	// ProxyHeader names the header (e.g. X-Forwarded-For) holding the
+	// client address when running behind a reverse proxy. It is only
+	// trusted on requests from TrustedProxies.
+	ProxyHeader    string   `json:"proxy_header"`
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	Storage    StorageConfig    `json:"storage"`
+	Retention  RetentionPolicy  `json:"retention"`
+	Federation FederationConfig `json:"federation"`
+}
+
+var defaultConfig = Config{
+	MongoURI:  "mongodb://localhost:27017",
+	Database:  "library",
+	Port:      3000,
+	Storage:   StorageConfig{Driver: "local", Path: "data"},
+	Retention: RetentionPolicy{InactiveYears: 0, NoticeDays: 30},
+}
+
+// loadConfig reads a JSON config file on top of the defaults. An empty
+// path yields the defaults unchanged.
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Borrow and return update the book and the user in separate writes, so a
+// failure halfway leaves them disagreeing. The book's borrower_id is
+// written first and is treated as the source of truth when repairing.
+const (
+	ViolationUserBookNotBorrowed = "user_book_not_borrowed"
+	ViolationBookMissingFromUser = "book_missing_from_user"
+	ViolationBorrowerDeleted     = "borrower_deleted"
+	ViolationLoanUserDeleted     = "loan_user_deleted"
+	ViolationLoanNotBorrowed     = "loan_not_borrowed"
+)
+
+type Violation struct {
+	Kind   string              `json:"kind"`
+	UserID primitive.ObjectID  `json:"user_id"`
+	BookID primitive.ObjectID  `json:"book_id"`
+	LoanID *primitive.ObjectID `json:"loan_id,omitempty"`
+	Repair string              `json:"repair"`
+}
+
+type ConsistencyReport struct {
+	DryRun     bool        `json:"dry_run"`
+	Violations []Violation `json:"violations"`
+	Repaired   int         `json:"repaired"`
+	Resolved   int         `json:"resolved"`
+	Errors     []string    `json:"errors,omitempty"`
+}
+
+func checkConsistency(ctx context.Context, dryRun bool) (*ConsistencyReport, error) {
+	var users []User
+	cursor, err := userCollection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"books": 1}))
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	var books []Book
+	cursor, err = bookCollection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"borrower_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &books); err != nil {
+		return nil, err
+	}
+
+	var loans []Loan
+	cursor, err = loanCollection.Find(ctx, bson.M{"returned_at": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &loans); err != nil {
+		return nil, err
+	}
+
+	userBooks := map[primitive.ObjectID]map[primitive.ObjectID]bool{}
+	for _, u := range users {
+		userBooks[u.ID] = map[primitive.ObjectID]bool{}
+		for _, b := range u.Books {
+			userBooks[u.ID][b] = true
+		}
+	}
+	borrower := map[primitive.ObjectID]primitive.ObjectID{}
+	for _, b := range books {
+		if b.BorrowerID != nil {
+			borrower[b.ID] = *b.BorrowerID
+		}
+	}
+
+	report := &ConsistencyReport{DryRun: dryRun, Violations: []Violation{}}
+
+	for userID, held := range userBooks {
+		for bookID := range held {
+			if borrower[bookID] != userID {
+				report.Violations = append(report.Violations, Violation{
+					Kind: ViolationUserBookNotBorrowed, UserID: userID, BookID: bookID,
+					Repair: "kitap kullanıcının listesinden çıkarılır",
+				})
+			}
+		}
+	}
+	for bookID, userID := range borrower {
+		held, exists := userBooks[userID]
+		switch {
+		case !exists:
+			report.Violations = append(report.Violations, Violation{
+				Kind: ViolationBorrowerDeleted, UserID: userID, BookID: bookID,
+				Repair: "kitabın borrower_id alanı temizlenir",
+			})
+		case !held[bookID]:
+			report.Violations = append(report.Violations, Violation{
+				Kind: ViolationBookMissingFromUser, UserID: userID, BookID: bookID,
+				Repair: "kitap kullanıcının listesine eklenir",
+			})
+		}
+	}
+	for _, loan := range loans {
+		loanID := loan.ID
+		if _, exists := userBooks[loan.UserID]; !exists {
+			report.Violations = append(report.Violations, Violation{
+				Kind: ViolationLoanUserDeleted, UserID: loan.UserID, BookID: loan.BookID, LoanID: &loanID,
+				Repair: "ödünç kaydı kapatılır",
+			})
+		} else if borrower[loan.BookID] != loan.UserID {
+			report.Violations = append(report.Violations, Violation{
+				Kind: ViolationLoanNotBorrowed, UserID: loan.UserID, BookID: loan.BookID, LoanID: &loanID,
+				Repair: "ödünç kaydı kapatılır",
+			})
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	now := time.Now()
+	for _, v := range report.Violations {
+		repaired, err := repairViolation(ctx, v, now)
+		if err != nil {
+			report.Errors = append(report.Errors, v.Kind+" "+v.BookID.Hex()+": "+err.Error())
+			continue
+		}
+		if repaired {
+			report.Repaired++
+		} else {
+			report.Resolved++
+		}
+	}
+	if report.Repaired > 0 {
+		bustAggregates(tagLoans, tagBooks, tagUsers)
+	}
+
+	return report, nil
+}
+
+// repairViolation fixes v if it still holds. Borrows and returns may have
+// run since the snapshot was taken, so each write re-checks the invariant
+// in its filter and reports false when there was nothing left to repair.
+func repairViolation(ctx context.Context, v Violation, now time.Time) (bool, error) {
+	var res *mongo.UpdateResult
+	var err error
+	switch v.Kind {
+	case ViolationUserBookNotBorrowed:
+		if lent, err := borrowedBy(ctx, v.BookID, v.UserID); err != nil || lent {
+			return false, err
+		}
+		res, err = userCollection.UpdateOne(ctx,
+			bson.M{"_id": v.UserID, "books": v.BookID},
+			bson.M{"$pull": bson.M{"books": v.BookID}},
+		)
+	case ViolationBookMissingFromUser:
+		if lent, err := borrowedBy(ctx, v.BookID, v.UserID); err != nil || !lent {
+			return false, err
+		}
+		res, err = userCollection.UpdateOne(ctx,
+			bson.M{"_id": v.UserID, "books": bson.M{"$ne": v.BookID}},
+			bson.M{"$addToSet": bson.M{"books": v.BookID}},
+		)
+	case ViolationBorrowerDeleted:
+		res, err = bookCollection.UpdateOne(ctx,
+			bson.M{"_id": v.BookID, "borrower_id": v.UserID},
+			bson.M{"$set": bson.M{"borrower_id": nil}},
+		)
+	case ViolationLoanNotBorrowed:
+		if lent, err := borrowedBy(ctx, v.BookID, v.UserID); err != nil || lent {
+			return false, err
+		}
+		fallthrough
+	case ViolationLoanUserDeleted:
+		res, err = loanCollection.UpdateOne(ctx,
+			bson.M{"_id": v.LoanID, "returned_at": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"returned_at": now}},
+		)
+	default:
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+func borrowedBy(ctx context.Context, bookID, userID primitive.ObjectID) (bool, error) {
+	n, err := bookCollection.CountDocuments(ctx, bson.M{"_id": bookID, "borrower_id": userID})
+	return n > 0, err
+}
+
+func consistencyCheck(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageSystem) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	report, err := checkConsistency(ctx, c.QueryBool("dry_run", true))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Tutarlılık kontrolü yapılamadı"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(report)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string
+	}{
+		{"every minute", "* * * * *", "2026-03-10 08:15", "2026-03-10 08:16"},
+		{"strictly after", "0 8 * * *", "2026-03-10 08:00", "2026-03-11 08:00"},
+		{"minute step", "*/15 * * * *", "2026-03-10 08:16", "2026-03-10 08:30"},
+		{"ranged step", "10-50/20 * * * *", "2026-03-10 08:31", "2026-03-10 08:50"},
+		{"list", "0 9,17 * * *", "2026-03-10 09:30", "2026-03-10 17:00"},
+		{"weekly on monday", "0 8 * * 1", "2026-03-10 08:00", "2026-03-16 08:00"},
+		{"sunday as 7", "0 8 * * 7", "2026-03-10 08:00", "2026-03-15 08:00"},
+		{"monthly rolls over", "0 6 1 * *", "2026-03-10 08:00", "2026-04-01 06:00"},
+		{"year rolls over", "0 0 1 1 *", "2026-03-10 08:00", "2027-01-01 00:00"},
+		{"31st skips short months", "0 0 31 * *", "2026-03-31 00:00", "2026-05-31 00:00"},
+		{"leap day", "0 0 29 2 *", "2026-03-10 08:00", "2028-02-29 00:00"},
+		// With both day fields restricted, either one matching is enough.
+		{"dom or dow, dow first", "0 0 15 * 5", "2026-03-10 08:00", "2026-03-13 00:00"},
+		{"dom or dow, dom first", "0 0 11 * 5", "2026-03-10 08:00", "2026-03-11 00:00"},
+		// A starred day field defers to the other one.
+		{"dom with starred dow", "0 0 15 * *", "2026-03-10 08:00", "2026-03-15 00:00"},
+		{"dow with starred dom", "0 0 * * 5", "2026-03-10 08:00", "2026-03-13 00:00"},
+	}
+
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: parseCron(%q): %v", tt.name, tt.expr, err)
+		}
+		if got := s.next(at(tt.from)); !got.Equal(at(tt.want)) {
+			t.Errorf("%s: next(%s) = %s, want %s", tt.name, tt.from, got.Format("2006-01-02 15:04"), tt.want)
+		}
+	}
+}
+
+// Hours are wall-clock hours in the schedule's location, including zones
+// whose offset is not a whole number of hours.
+func TestCronNextLocation(t *testing.T) {
+	s, err := parseCron("0 8 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, loc := range []*time.Location{
+		time.FixedZone("IST", 5*3600+1800),
+		time.FixedZone("NPT", 5*3600+2700),
+		time.FixedZone("TRT", 3*3600),
+	} {
+		from := time.Date(2026, 3, 10, 9, 0, 0, 0, loc)
+		want := time.Date(2026, 3, 11, 8, 0, 0, 0, loc)
+		if got := s.next(from); !got.Equal(want) {
+			t.Errorf("%s: next(%s) = %s, want %s", loc, from, got, want)
+		}
+	}
+}
+
+func TestCronNextNeverMatches(t *testing.T) {
+	for _, expr := range []string{"0 0 30 2 *", "0 0 31 4,6,9,11 *"} {
+		s, err := parseCron(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.next(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+			t.Errorf("%q next = %s, want zero time", expr, got)
+		}
+	}
+}
+
+func TestReportRetryDelay(t *testing.T) {
+	want := []time.Duration{5 * time.Minute, 10 * time.Minute, 20 * time.Minute, 40 * time.Minute, time.Hour, time.Hour}
+	for i, w := range want {
+		if got := reportRetryDelay(i + 1); got != w {
+			t.Errorf("reportRetryDelay(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FederationConfig lists partner libraries running this same API. Each
+// peer's Key is what we send to them in X-Federation-Key; InboundKey is
+// what they must send to file loan requests here, and identifies them.
+type FederationConfig struct {
+	Name  string       `json:"name"`
+	Peers []PeerConfig `json:"peers"`
+}
+
+type PeerConfig struct {
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	Key        string `json:"key"`
+	InboundKey string `json:"inbound_key"`
+}
+
+var federation FederationConfig
+
+var peerClient = &http.Client{Timeout: 5 * time.Second}
+
+// Limits on what a single peer can add to a federated search.
+const (
+	maxPeerResults       = 50
+	maxPeerResponseBytes = 1 << 20
+)
+
+// FederatedBook is a search hit; HeldAt names the partner library holding
+// it and is empty for our own books.
+type FederatedBook struct {
+	Book
+	HeldAt string `json:"held_at,omitempty"`
+}
+
+type ILLRequest struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Peer        string             `bson:"peer" json:"peer"`
+	BookID      primitive.ObjectID `bson:"book_id" json:"book_id"`
+	Title       string             `bson:"title" json:"title"`
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	RemoteID    string             `bson:"remote_id,omitempty" json:"remote_id,omitempty"`
+	Status      string             `bson:"status" json:"status"`
+	Error       string             `bson:"error,omitempty" json:"error,omitempty"`
+	RequestedAt time.Time          `bson:"requested_at" json:"requested_at"`
+}
+
+type IncomingILLRequest struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Library     string             `bson:"library" json:"library"`
+	BookID      primitive.ObjectID `bson:"book_id" json:"book_id"`
+	PatronRef   string             `bson:"patron_ref" json:"patron_ref"`
+	Status      string             `bson:"status" json:"status"`
+	RequestedAt time.Time          `bson:"requested_at" json:"requested_at"`
+}
+
+func findPeer(name string) (PeerConfig, bool) {
+	for _, p := range federation.Peers {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return PeerConfig{}, false
+}
+
+// peerByInboundKey finds the partner that sent key. Every peer is compared
+// so the time taken does not reveal which one matched.
+func peerByInboundKey(key string) (PeerConfig, bool) {
+	var found PeerConfig
+	ok := false
+	for _, p := range federation.Peers {
+		if p.InboundKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(p.InboundKey)) == 1 {
+			found, ok = p, true
+		}
+	}
+	return found, ok
+}
+
+// searchPeers queries every peer's /books concurrently. Peers that fail
+// or time out are logged and left out of the results.
+func searchPeers(ctx context.Context, q, acceptLanguage string) []FederatedBook {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []FederatedBook
+	)
+
+	for _, peer := range federation.Peers {
+		wg.Add(1)
+		go func(peer PeerConfig) {
+			defer wg.Done()
+
+			books, err := fetchPeerBooks(ctx, peer, q, acceptLanguage)
+			if err != nil {
+				log.Printf("Ortak kütüphane sorgulanamadı (%s): %v", peer.Name, err)
+				return
+			}
+
+			mu.Lock()
+			for _, b := range books {
+				results = append(results, FederatedBook{Book: b, HeldAt: peer.Name})
+			}
+			mu.Unlock()
+		}(peer)
+	}
+
+	wg.Wait()
+	return results
+}
+
+func fetchPeerBooks(ctx context.Context, peer PeerConfig, q, acceptLanguage string) ([]Book, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(peer.URL, "/")+"/books?q="+url.QueryEscape(q), nil)
+	if err != nil {
+		return nil, err
+	}
+	if acceptLanguage != "" {
+		req.Header.Set(fiber.HeaderAcceptLanguage, acceptLanguage)
+	}
+
+	res, err := peerClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("beklenmeyen durum kodu %d", res.StatusCode)
+	}
+
+	var books []Book
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxPeerResponseBytes)).Decode(&books); err != nil {
+		return nil, err
+	}
+	if len(books) > maxPeerResults {
+		books = books[:maxPeerResults]
+	}
+	return books, nil
+}
+
+// mergeFederated appends partner hits for titles we do not hold ourselves.
+func mergeFederated(local []Book, remote []FederatedBook) []FederatedBook {
+	held := map[string]bool{}
+	merged := make([]FederatedBook, 0, len(local)+len(remote))
+	for _, b := range local {
+		held[strings.ToLower(b.Title)] = true
+		merged = append(merged, FederatedBook{Book: b})
+	}
+	for _, b := range remote {
+		title := strings.ToLower(b.Title)
+		if held[title] {
+			continue
+		}
+		held[title] = true
+		b.BorrowerID = nil
+		merged = append(merged, b)
+	}
+	return merged
+}
+
+func createILLRequest(c *fiber.Ctx) error {
+	type request struct {
+		UserID string `json:"user_id"`
+		Peer   string `json:"peer"`
+		BookID string `json:"book_id"`
+	}
+	var body request
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz JSON"})
+	}
+	userObjID, err := primitive.ObjectIDFromHex(body.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz user_id"})
+	}
+	bookObjID, err := primitive.ObjectIDFromHex(body.BookID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz book_id"})
+	}
+	if !authorize(c, userObjID, PermManageILL) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+	peer, ok := findPeer(body.Peer)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Bilinmeyen ortak kütüphane"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := userCollection.CountDocuments(ctx, bson.M{"_id": userObjID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Veritabanı hatası"})
+	}
+	if count == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kullanıcı bulunamadı"})
+	}
+
+	ill := ILLRequest{
+		Peer:        peer.Name,
+		BookID:      bookObjID,
+		UserID:      userObjID,
+		Status:      "requested",
+		RequestedAt: time.Now(),
+	}
+
+	remote, err := sendILLRequest(ctx, peer, bookObjID, userObjID)
+	if err != nil {
+		ill.Status = "failed"
+		ill.Error = err.Error()
+	} else {
+		ill.RemoteID = remote.ID.Hex()
+		ill.Title = remote.Title
+	}
+
+	res, err := illRequestCollection.InsertOne(ctx, ill)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ödünç talebi kaydedilemedi"})
+	}
+	ill.ID = res.InsertedID.(primitive.ObjectID)
+
+	if ill.Status == "failed" {
+		return c.Status(fiber.StatusBadGateway).JSON(ill)
+	}
+	return c.Status(fiber.StatusCreated).JSON(ill)
+}
+
+type illReceipt struct {
+	ID    primitive.ObjectID `json:"id"`
+	Title string             `json:"title"`
+}
+
+func sendILLRequest(ctx context.Context, peer PeerConfig, bookID, userID primitive.ObjectID) (*illReceipt, error) {
+	payload, err := json.Marshal(fiber.Map{
+		"library":    federation.Name,
+		"book_id":    bookID.Hex(),
+		"patron_ref": userID.Hex(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(peer.URL, "/")+"/ill/incoming", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set("X-Federation-Key", peer.Key)
+
+	res, err := peerClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(res.Body).Decode(&e)
+		return nil, fmt.Errorf("ortak kütüphane talebi reddetti (%d): %s", res.StatusCode, e.Error)
+	}
+
+	var receipt illReceipt
+	if err := json.NewDecoder(res.Body).Decode(&receipt); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+func listILLRequests(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageILL) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := illRequestCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"requested_at": -1}))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ödünç talepleri alınamadı"})
+	}
+	defer cursor.Close(ctx)
+
+	requests := []ILLRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ödünç talepleri parse edilemedi"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(requests)
+}
+
+// receiveILLRequest is called by partner libraries. It only records the
+// request for our circulation staff; nothing is checked out automatically.
+func receiveILLRequest(c *fiber.Ctx) error {
+	peer, ok := peerByInboundKey(c.Get("X-Federation-Key"))
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Geçersiz federasyon anahtarı"})
+	}
+
+	// The sender is the peer whose key matched; a library name in the body
+	// is ignored.
+	type request struct {
+		BookID    string `json:"book_id"`
+		PatronRef string `json:"patron_ref"`
+	}
+	var body request
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz JSON"})
+	}
+	bookObjID, err := primitive.ObjectIDFromHex(body.BookID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz book_id"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var book Book
+	if err := bookCollection.FindOne(ctx, bson.M{"_id": bookObjID}).Decode(&book); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kitap bulunamadı"})
+	}
+
+	incoming := IncomingILLRequest{
+		Library:     peer.Name,
+		BookID:      bookObjID,
+		PatronRef:   body.PatronRef,
+		Status:      "received",
+		RequestedAt: time.Now(),
+	}
+	res, err := illIncomingCollection.InsertOne(ctx, incoming)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ödünç talebi kaydedilemedi"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(illReceipt{ID: res.InsertedID.(primitive.ObjectID), Title: book.Title})
+}
+
+func listIncomingILLRequests(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageILL) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := illIncomingCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"requested_at": -1}))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ödünç talepleri alınamadı"})
+	}
+	defer cursor.Close(ctx)
+
+	requests := []IncomingILLRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ödünç talepleri parse edilemedi"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(requests)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSendCacheable(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	modTime := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	app := fiber.New()
+	app.Get("/file", func(c *fiber.Ctx) error {
+		return sendCacheable(c, data, "application/octet-stream", modTime, "private, max-age=60")
+	})
+
+	do := func(headers map[string]string) (*http.Response, string) {
+		req := httptest.NewRequest("GET", "/file", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		return res, string(body)
+	}
+
+	res, body := do(nil)
+	etag := res.Header.Get("ETag")
+	if res.StatusCode != 200 || body != string(data) || etag == "" {
+		t.Fatalf("plain GET: status %d, etag %q, body %q", res.StatusCode, etag, body)
+	}
+	if got := res.Header.Get("Last-Modified"); got != "Sun, 01 Mar 2026 12:00:00 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"if-none-match", map[string]string{"If-None-Match": etag}, 304, "", ""},
+		{"weak if-none-match in list", map[string]string{"If-None-Match": `"other", W/` + etag}, 304, "", ""},
+		{"if-none-match mismatch", map[string]string{"If-None-Match": `"other"`}, 200, string(data), ""},
+		{"if-modified-since", map[string]string{"If-Modified-Since": "Sun, 01 Mar 2026 12:00:00 GMT"}, 304, "", ""},
+		{"modified since", map[string]string{"If-Modified-Since": "Sat, 28 Feb 2026 12:00:00 GMT"}, 200, string(data), ""},
+		{"range", map[string]string{"Range": "bytes=2-5"}, 206, "2345", "bytes 2-5/20"},
+		{"open-ended range", map[string]string{"Range": "bytes=15-"}, 206, "fghij", "bytes 15-19/20"},
+		{"suffix range", map[string]string{"Range": "bytes=-3"}, 206, "hij", "bytes 17-19/20"},
+		{"unsatisfiable range", map[string]string{"Range": "bytes=50-60"}, 416, "Requested Range Not Satisfiable", "bytes */20"},
+		{"if-range etag match", map[string]string{"Range": "bytes=0-1", "If-Range": etag}, 206, "01", "bytes 0-1/20"},
+		{"if-range date match", map[string]string{"Range": "bytes=0-1", "If-Range": "Sun, 01 Mar 2026 12:00:00 GMT"}, 206, "01", "bytes 0-1/20"},
+		{"if-range mismatch", map[string]string{"Range": "bytes=0-1", "If-Range": `"stale"`}, 200, string(data), ""},
+		{"multiple ranges", map[string]string{"Range": "bytes=0-1,4-5"}, 200, string(data), ""},
+	}
+
+	for _, tt := range tests {
+		res, body := do(tt.headers)
+		if res.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, res.StatusCode, tt.status)
+			continue
+		}
+		if body != tt.body {
+			t.Errorf("%s: body %q, want %q", tt.name, body, tt.body)
+		}
+		if got := res.Header.Get("Content-Range"); got != tt.contentRange {
+			t.Errorf("%s: Content-Range %q, want %q", tt.name, got, tt.contentRange)
+		}
+		if got := res.Header.Get("ETag"); got != etag {
+			t.Errorf("%s: ETag %q, want %q", tt.name, got, etag)
+		}
+	}
+}
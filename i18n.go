@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/text/language"
+)
+
+const defaultCatalogLanguage = "tr"
+
+type BookTranslation struct {
+	Title       string `bson:"title" json:"title"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+}
+
+func (b *Book) language() string {
+	if b.Language == "" {
+		return defaultCatalogLanguage
+	}
+	return b.Language
+}
+
+// localized returns a copy of the book whose title and description are in
+// the best language for the Accept-Language header, falling back to the
+// book's own language.
+func (b Book) localized(acceptLanguage string) Book {
+	b.Language = b.language()
+	if len(b.Translations) == 0 || acceptLanguage == "" {
+		return b
+	}
+
+	desired, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(desired) == 0 {
+		return b
+	}
+
+	langs := []string{b.Language}
+	supported := []language.Tag{language.Make(b.Language)}
+	for lang := range b.Translations {
+		langs = append(langs, lang)
+		supported = append(supported, language.Make(lang))
+	}
+
+	_, index, confidence := language.NewMatcher(supported).Match(desired...)
+	if confidence == language.No || index == 0 {
+		return b
+	}
+
+	t := b.Translations[langs[index]]
+	b.Language = langs[index]
+	b.Title = t.Title
+	if t.Description != "" {
+		b.Description = t.Description
+	}
+	return b
+}
+
+// canonicalLanguageTag validates tag and returns its canonical form, so
+// "EN" and "en" are stored under the same key.
+func canonicalLanguageTag(tag string) (string, bool) {
+	t, err := language.Parse(tag)
+	if err != nil {
+		return "", false
+	}
+	return t.String(), true
+}
+
+func setBookTranslation(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageCatalog) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	bookObjID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz kitap ID"})
+	}
+	lang, ok := canonicalLanguageTag(c.Params("lang"))
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz dil kodu"})
+	}
+
+	var body BookTranslation
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz JSON"})
+	}
+	if body.Title == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "title zorunlu"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := bookCollection.UpdateOne(ctx,
+		bson.M{"_id": bookObjID},
+		bson.M{"$set": bson.M{"translations." + lang: body}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kitap güncellenemedi"})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kitap bulunamadı"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Çeviri kaydedildi"})
+}
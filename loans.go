@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const loanPeriod = 14 * 24 * time.Hour
+
+type Loan struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+	BookID     primitive.ObjectID `bson:"book_id" json:"book_id"`
+	BorrowedAt time.Time          `bson:"borrowed_at" json:"borrowed_at"`
+	DueAt      time.Time          `bson:"due_at" json:"due_at"`
+	ReturnedAt *time.Time         `bson:"returned_at,omitempty" json:"returned_at,omitempty"`
+}
+
+// Loan history is best effort: circulation already succeeded by the time
+// these run, so failures are logged rather than returned to the client.
+func recordLoan(ctx context.Context, userID, bookID primitive.ObjectID) {
+	now := time.Now()
+	loan := Loan{
+		UserID:     userID,
+		BookID:     bookID,
+		BorrowedAt: now,
+		DueAt:      now.Add(loanPeriod),
+	}
+	if _, err := loanCollection.InsertOne(ctx, loan); err != nil {
+		log.Println("Ödünç kaydı oluşturulamadı:", err)
+	}
+	bustAggregates(tagLoans)
+}
+
+func closeLoan(ctx context.Context, userID, bookID primitive.ObjectID) {
+	_, err := loanCollection.UpdateOne(ctx,
+		bson.M{"user_id": userID, "book_id": bookID, "returned_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"returned_at": time.Now()}},
+	)
+	if err != nil {
+		log.Println("Ödünç kaydı kapatılamadı:", err)
+	}
+	bustAggregates(tagLoans)
+}
+
+func getUserLoans(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz kullanıcı ID"})
+	}
+	if !authorize(c, objID, PermViewLoanHistory) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := loanCollection.Find(ctx,
+		bson.M{"user_id": objID},
+		options.Find().SetSort(bson.M{"borrowed_at": -1}),
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ödünç geçmişi alınamadı"})
+	}
+	defer cursor.Close(ctx)
+
+	loans := []Loan{}
+	if err := cursor.All(ctx, &loans); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Ödünç geçmişi parse edilemedi"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(loans)
+}
+
+const latenessCacheTTL = time.Hour
+
+// averageLateness is the mean time past the due date over the most recent
+// returned loans. Early returns count as on time.
+func averageLateness(ctx context.Context) (time.Duration, error) {
+	v, err := cachedAggregate("loans:average_lateness", latenessCacheTTL, []string{tagLoans}, func() (interface{}, error) {
+		return loadAverageLateness(ctx)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return v.(time.Duration), nil
+}
+
+func loadAverageLateness(ctx context.Context) (time.Duration, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"returned_at": bson.M{"$exists": true}, "due_at": bson.M{"$exists": true}}}},
+		{{Key: "$sort", Value: bson.M{"returned_at": -1}}},
+		{{Key: "$limit", Value: 500}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      nil,
+			"lateness": bson.M{"$avg": bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{"$returned_at", "$due_at"}}}}},
+		}}},
+	}
+
+	cursor, err := loanCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Lateness float64 `bson:"lateness"`
+	}
+	if err := cursor.All(ctx, &results); err != nil || len(results) == 0 {
+		return 0, err
+	}
+	return time.Duration(results[0].Lateness) * time.Millisecond, nil
+}
+
+// estimateAvailability predicts when a borrowed book will be back on the
+// shelf: the open loan's due date pushed back by the average lateness,
+// and never earlier than now. It returns nil for books on the shelf.
+func estimateAvailability(ctx context.Context, book *Book) (*time.Time, error) {
+	books := []Book{*book}
+	if err := estimateAvailabilities(ctx, books); err != nil {
+		return nil, err
+	}
+	return books[0].EstimatedAvailableAt, nil
+}
+
+// estimateAvailabilities sets EstimatedAvailableAt on every borrowed book
+// in books, looking up their open loans in a single query.
+func estimateAvailabilities(ctx context.Context, books []Book) error {
+	borrowers := map[primitive.ObjectID]primitive.ObjectID{}
+	var ids []primitive.ObjectID
+	for _, b := range books {
+		if b.BorrowerID != nil {
+			borrowers[b.ID] = *b.BorrowerID
+			ids = append(ids, b.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	cursor, err := loanCollection.Find(ctx, bson.M{
+		"book_id":     bson.M{"$in": ids},
+		"returned_at": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return err
+	}
+	var loans []Loan
+	if err := cursor.All(ctx, &loans); err != nil {
+		return err
+	}
+	if len(loans) == 0 {
+		return nil
+	}
+
+	lateness, err := averageLateness(ctx)
+	if err != nil {
+		return err
+	}
+
+	open := make(map[primitive.ObjectID]Loan, len(loans))
+	for _, l := range loans {
+		if borrowers[l.BookID] == l.UserID {
+			open[l.BookID] = l
+		}
+	}
+	now := time.Now()
+	for i, b := range books {
+		loan, ok := open[b.ID]
+		if !ok {
+			continue
+		}
+		estimate := loan.DueAt.Add(lateness)
+		if estimate.Before(now) {
+			estimate = now
+		}
+		books[i].EstimatedAvailableAt = &estimate
+	}
+	return nil
+}
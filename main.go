@@ -2,7 +2,13 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"net/mail"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -12,30 +18,56 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/sync/singleflight"
 )
 
 
 var userCollection *mongo.Collection
 var bookCollection *mongo.Collection
+var floorMapCollection *mongo.Collection
+var loanCollection *mongo.Collection
+var reportSubscriptionCollection *mongo.Collection
+var settingsCollection *mongo.Collection
+var broadcastCollection *mongo.Collection
+var illRequestCollection *mongo.Collection
+var illIncomingCollection *mongo.Collection
+
+var bookReads singleflight.Group
 
 
 type User struct {
 	ID       primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
 	Username string               `bson:"username" json:"username"`
 	Password string               `bson:"password,omitempty" json:"-"` 
+	Email    string               `bson:"email,omitempty" json:"email,omitempty"`
 	Books    []primitive.ObjectID `bson:"books" json:"books"`         
+	Role     Role                 `bson:"role,omitempty" json:"role"`
+
+	PhotoUpdatedAt    *time.Time `bson:"photo_updated_at,omitempty" json:"photo_updated_at,omitempty"`
+	LastActiveAt      *time.Time `bson:"last_active_at,omitempty" json:"last_active_at,omitempty"`
+	DormantNotifiedAt *time.Time `bson:"dormant_notified_at,omitempty" json:"dormant_notified_at,omitempty"`
+	AnonymizedAt      *time.Time `bson:"anonymized_at,omitempty" json:"anonymized_at,omitempty"`
 }
 
 
 type Book struct {
-	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
-	Title      string              `bson:"title" json:"title"`
-	BorrowerID *primitive.ObjectID `bson:"borrower_id,omitempty" json:"borrower_id,omitempty"`
+	ID            primitive.ObjectID         `bson:"_id,omitempty" json:"id"`
+	Title         string                     `bson:"title" json:"title"`
+	Slug          string                     `bson:"slug,omitempty" json:"slug,omitempty"`
+	PreviousSlugs []string                   `bson:"previous_slugs,omitempty" json:"-"`
+	Description   string                     `bson:"description,omitempty" json:"description,omitempty"`
+	Language      string                     `bson:"language,omitempty" json:"language,omitempty"`
+	Translations  map[string]BookTranslation `bson:"translations,omitempty" json:"translations,omitempty"`
+	BorrowerID    *primitive.ObjectID        `bson:"borrower_id,omitempty" json:"borrower_id,omitempty"`
+	Location      *ShelfLocation             `bson:"location,omitempty" json:"location,omitempty"`
+
+	Available            bool       `bson:"-" json:"available"`
+	EstimatedAvailableAt *time.Time `bson:"-" json:"estimated_available_at,omitempty"`
 }
 
 
-func connectDB() *mongo.Client {
-	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+func connectDB(uri string) *mongo.Client {
+	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
 	if err != nil {
 		log.Fatal("MongoDB Client oluşturulamadı:", err)
 	}
@@ -61,32 +93,126 @@ func checkPasswordHash(password, hashed string) bool {
 }
 
 func main() {
-	
-	client := connectDB()
-	db := client.Database("library")
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "serve":
+		serveCommand(args)
+	case "migrate":
+		migrateCommand(args)
+	case "seed":
+		seedCommand(args)
+	case "create-admin":
+		createAdminCommand(args)
+	case "export":
+		exportCommand(args)
+	case "check":
+		checkCommand(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Bilinmeyen komut: %s\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+}
+
+
+func initCollections(db *mongo.Database) {
 	userCollection = db.Collection("users")
 	bookCollection = db.Collection("books")
+	floorMapCollection = db.Collection("floor_maps")
+	loanCollection = db.Collection("loans")
+	reportSubscriptionCollection = db.Collection("report_subscriptions")
+	settingsCollection = db.Collection("settings")
+	broadcastCollection = db.Collection("broadcasts")
+	illRequestCollection = db.Collection("ill_requests")
+	illIncomingCollection = db.Collection("ill_incoming")
+}
+
+func serve(cfg Config) {
+	loadMaintenanceState()
+	loadRateLimits()
+	failInterruptedBroadcasts()
 
 	
-	app := fiber.New()
+	// The default 4 MB body limit would cut off photo uploads below
+	// maxPhotoBytes; leave room for the multipart framing.
+	// Behind a proxy every request comes from the proxy's address, so the
+	// rate limiter needs the client address from ProxyHeader.
+	app := fiber.New(fiber.Config{
+		BodyLimit:               maxPhotoBytes + 1<<20,
+		ProxyHeader:             cfg.ProxyHeader,
+		EnableTrustedProxyCheck: cfg.ProxyHeader != "",
+		TrustedProxies:          cfg.TrustedProxies,
+		EnableIPValidation:      true,
+	})
 
 	
 	app.Use(logger.New())
+	app.Use(rateLimiter)
+	app.Use(loadActor)
+	app.Use(maintenanceGuard)
 
 	
 	app.Post("/register", registerUser)
 	app.Post("/login", loginUser)
+	app.Get("/users", findUsers)
 	app.Get("/user/:id", getUser)
 	app.Delete("/user/:id", deleteUser)
+	app.Get("/user/:id/loans", getUserLoans)
+	app.Put("/user/:id/role", setUserRole)
+	app.Post("/user/:id/photo", uploadPhoto)
+	app.Get("/user/:id/card.png", userCard)
 
 	app.Post("/book", addBook)
 	app.Get("/books", listBooks)
+	app.Get("/book/:id", getBook)
+	app.Patch("/book/:id", updateBook)
+	app.Put("/book/:id/location", setBookLocation)
+	app.Put("/book/:id/translations/:lang", setBookTranslation)
+	app.Get("/book/:id/wayfinding", bookWayfinding)
+
+	app.Post("/floor-map", saveFloorMap)
+
+	app.Get("/catalog/:slug", catalogBook)
+
+	app.Post("/admin/report-subscriptions", createReportSubscription)
+	app.Get("/admin/report-subscriptions", listReportSubscriptions)
+	app.Delete("/admin/report-subscriptions/:id", deleteReportSubscription)
+
+	app.Get("/admin/maintenance", getMaintenance)
+	app.Put("/admin/maintenance", setMaintenance)
+
+	app.Get("/admin/rate-limits", getRateLimits)
+	app.Put("/admin/rate-limits", setRateLimits)
+
+	app.Post("/admin/consistency-check", consistencyCheck)
+
+	app.Post("/admin/broadcast", createBroadcast)
+	app.Get("/admin/broadcast/:id", getBroadcast)
+
+	app.Get("/admin/retention/upcoming", upcomingExpirations)
+	app.Post("/admin/retention/run", runRetentionNow)
+
+	app.Use("/admin/ui", adminUIHandler())
 
 	app.Post("/borrow", borrowBook)
 	app.Post("/return", returnBook)
 
+	app.Post("/ill-requests", createILLRequest)
+	app.Get("/ill-requests", listILLRequests)
+	app.Post("/ill/incoming", receiveILLRequest)
+	app.Get("/ill/incoming", listIncomingILLRequests)
+
+	go runReportScheduler()
+	go sweepBuckets()
+	go runRetentionJob()
+
 	
-	log.Fatal(app.Listen(":3000"))
+	log.Fatal(app.Listen(":" + strconv.Itoa(cfg.Port)))
 }
 
 
@@ -94,12 +220,18 @@ func registerUser(c *fiber.Ctx) error {
 	type request struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		Email    string `json:"email"`
 	}
 	var body request
 
 	if err := c.BodyParser(&body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz JSON"})
 	}
+	if body.Email != "" {
+		if _, err := mail.ParseAddress(body.Email); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz e-posta adresi"})
+		}
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -118,10 +250,14 @@ func registerUser(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Şifre hashlenemedi"})
 	}
 
+	now := time.Now()
 	user := User{
-		Username: body.Username,
-		Password: hashed,
-		Books:    []primitive.ObjectID{},
+		Username:     body.Username,
+		Password:     hashed,
+		Email:        body.Email,
+		Books:        []primitive.ObjectID{},
+		Role:         RolePatron,
+		LastActiveAt: &now,
 	}
 
 	res, err := userCollection.InsertOne(ctx, user)
@@ -157,9 +293,13 @@ func loginUser(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Hatalı şifre"})
 	}
 
+	touchUser(ctx, user.ID)
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Giriş başarılı",
 		"user_id": user.ID,
+		"role":    user.role(),
+		"token":   issueSessionToken(user.ID, time.Now()),
 	})
 }
 
@@ -169,6 +309,9 @@ func getUser(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz kullanıcı ID"})
 	}
+	if !authorize(c, objID, PermViewCurrentLoans) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -182,12 +325,42 @@ func getUser(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(user)
 }
 
+func findUsers(c *fiber.Ctx) error {
+	if !hasPermission(c, PermViewCurrentLoans) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	filter := bson.M{}
+	if q := c.Query("q"); q != "" {
+		filter["username"] = primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := userCollection.Find(ctx, filter, options.Find().SetLimit(50))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kullanıcılar alınamadı"})
+	}
+	defer cursor.Close(ctx)
+
+	users := []User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kullanıcılar parse edilemedi"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(users)
+}
+
 func deleteUser(c *fiber.Ctx) error {
 	id := c.Params("id")
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz kullanıcı ID"})
 	}
+	if !authorize(c, objID, PermManageUsers) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -199,27 +372,68 @@ func deleteUser(c *fiber.Ctx) error {
 	if res.DeletedCount == 0 {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kullanıcı bulunamadı"})
 	}
+	bustAggregates(tagUsers)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Kullanıcı silindi"})
 }
 
 
 func addBook(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageCatalog) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
 	type request struct {
-		Title string `json:"title"`
+		Title        string                     `json:"title"`
+		Description  string                     `json:"description"`
+		Language     string                     `json:"language"`
+		Translations map[string]BookTranslation `json:"translations"`
 	}
 	var body request
 
 	if err := c.BodyParser(&body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz JSON"})
 	}
+	if body.Language == "" {
+		body.Language = defaultCatalogLanguage
+	}
+	language, ok := canonicalLanguageTag(body.Language)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz dil kodu"})
+	}
+	body.Language = language
+
+	translations := make(map[string]BookTranslation, len(body.Translations))
+	for lang, t := range body.Translations {
+		tag, ok := canonicalLanguageTag(lang)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz dil kodu: " + lang})
+		}
+		if t.Title == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Çeviri için title zorunlu: " + lang})
+		}
+		if _, dup := translations[tag]; dup {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Aynı dil birden fazla kez verilmiş: " + lang})
+		}
+		translations[tag] = t
+	}
+	body.Translations = translations
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	slug, err := uniqueSlug(ctx, body.Title, primitive.NilObjectID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Veritabanı hatası"})
+	}
+
 	book := Book{
-		Title:      body.Title,
-		BorrowerID: nil,
+		Title:        body.Title,
+		Slug:         slug,
+		Description:  body.Description,
+		Language:     body.Language,
+		Translations: body.Translations,
+		BorrowerID:   nil,
 	}
 
 	res, err := bookCollection.InsertOne(ctx, book)
@@ -227,14 +441,24 @@ func addBook(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kitap eklenemedi"})
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"inserted_id": res.InsertedID})
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"inserted_id": res.InsertedID, "slug": slug})
 }
 
 func listBooks(c *fiber.Ctx) error {
+	federated := c.QueryBool("federated") && len(federation.Peers) > 0
+	if federated && c.Query("q") == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Ortak katalog araması için q zorunlu"})
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	cursor, err := bookCollection.Find(ctx, bson.M{})
+	filter := bson.M{}
+	if q := c.Query("q"); q != "" {
+		filter["title"] = primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+	}
+
+	cursor, err := bookCollection.Find(ctx, filter)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kitaplar alınamadı"})
 	}
@@ -244,10 +468,60 @@ func listBooks(c *fiber.Ctx) error {
 	if err := cursor.All(ctx, &books); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kitaplar parse edilemedi"})
 	}
+	if err := estimateAvailabilities(ctx, books); err != nil {
+		log.Println("Tahmini müsaitlik hesaplanamadı:", err)
+	}
 
+	acceptLanguage := c.Get(fiber.HeaderAcceptLanguage)
+	for i := range books {
+		books[i] = books[i].localized(acceptLanguage)
+		redactBorrower(c, &books[i])
+	}
+
+	c.Vary(fiber.HeaderAcceptLanguage)
+	if federated {
+		remote := searchPeers(ctx, c.Query("q"), acceptLanguage)
+		return c.Status(fiber.StatusOK).JSON(mergeFederated(books, remote))
+	}
 	return c.Status(fiber.StatusOK).JSON(books)
 }
 
+func getBook(c *fiber.Ctx) error {
+	bookObjID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz kitap ID"})
+	}
+
+	// Concurrent reads of the same book share a single query.
+	v, err, _ := bookReads.Do(bookObjID.Hex(), func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var book Book
+		if err := bookCollection.FindOne(ctx, bson.M{"_id": bookObjID}).Decode(&book); err != nil {
+			return book, err
+		}
+		estimate, err := estimateAvailability(ctx, &book)
+		if err != nil {
+			log.Println("Tahmini müsaitlik hesaplanamadı:", err)
+		}
+		book.EstimatedAvailableAt = estimate
+		return book, nil
+	})
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kitap bulunamadı"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kitap alınamadı"})
+	}
+
+	book := v.(Book).localized(c.Get(fiber.HeaderAcceptLanguage))
+	redactBorrower(c, &book)
+	c.Vary(fiber.HeaderAcceptLanguage)
+	c.Set(fiber.HeaderContentLanguage, book.Language)
+	return c.Status(fiber.StatusOK).JSON(book)
+}
+
 
 func borrowBook(c *fiber.Ctx) error {
 	type request struct {
@@ -271,6 +545,9 @@ func borrowBook(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz book_id"})
 	}
+	if !authorize(c, userObjID, PermCirculate) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
 
 
 	var user User
@@ -304,13 +581,16 @@ func borrowBook(c *fiber.Ctx) error {
 	
 	_, err = userCollection.UpdateOne(ctx,
 		bson.M{"_id": userObjID},
-		bson.M{"$push": bson.M{"books": bookObjID}},
+		bson.M{"$addToSet": bson.M{"books": bookObjID}},
 	)
 	if err != nil {
 		bookCollection.UpdateOne(ctx, bson.M{"_id": bookObjID}, bson.M{"$set": bson.M{"borrower_id": nil}})
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kullanıcı güncellenemedi"})
 	}
 
+	recordLoan(ctx, userObjID, bookObjID)
+	touchUser(ctx, userObjID)
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Kitap başarıyla ödünç alındı"})
 }
 
@@ -336,6 +616,9 @@ func returnBook(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz book_id"})
 	}
+	if !authorize(c, userObjID, PermCirculate) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
 
 
 	var book Book
@@ -365,5 +648,8 @@ func returnBook(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kullanıcı güncellenemedi"})
 	}
 
+	closeLoan(ctx, userObjID, bookObjID)
+	touchUser(ctx, userObjID)
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Kitap başarıyla iade edildi"})
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultMaintenanceMessage = "Kütüphane sistemi bakımda, lütfen daha sonra tekrar deneyin."
+
+type MaintenanceState struct {
+	Enabled bool       `bson:"enabled" json:"enabled"`
+	Message string     `bson:"message" json:"message"`
+	Since   *time.Time `bson:"since,omitempty" json:"since,omitempty"`
+}
+
+var maintenance struct {
+	sync.RWMutex
+	state MaintenanceState
+}
+
+func currentMaintenance() MaintenanceState {
+	maintenance.RLock()
+	defer maintenance.RUnlock()
+	return maintenance.state
+}
+
+func loadMaintenanceState() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var state MaintenanceState
+	if err := settingsCollection.FindOne(ctx, bson.M{"_id": "maintenance"}).Decode(&state); err != nil {
+		return
+	}
+
+	maintenance.Lock()
+	maintenance.state = state
+	maintenance.Unlock()
+	if state.Enabled {
+		log.Println("Bakım modu açık:", state.Message)
+	}
+}
+
+// maintenanceGuard rejects patron traffic while maintenance mode is on.
+// Staff accounts, /login and the /admin endpoints stay reachable.
+func maintenanceGuard(c *fiber.Ctx) error {
+	state := currentMaintenance()
+	if !state.Enabled {
+		return c.Next()
+	}
+	if c.Path() == "/login" || strings.HasPrefix(c.Path(), "/admin/") {
+		return c.Next()
+	}
+	if actor := currentActor(c); actor != nil && actor.role() != RolePatron {
+		return c.Next()
+	}
+
+	c.Set(fiber.HeaderRetryAfter, "600")
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"error":       state.Message,
+		"maintenance": true,
+		"since":       state.Since,
+	})
+}
+
+func getMaintenance(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageSystem) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+	return c.Status(fiber.StatusOK).JSON(currentMaintenance())
+}
+
+func setMaintenance(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageSystem) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	type request struct {
+		Enabled bool   `json:"enabled"`
+		Message string `json:"message"`
+	}
+	var body request
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz JSON"})
+	}
+
+	state := MaintenanceState{Enabled: body.Enabled}
+	if body.Enabled {
+		now := time.Now()
+		state.Since = &now
+		state.Message = body.Message
+		if state.Message == "" {
+			state.Message = defaultMaintenanceMessage
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := settingsCollection.ReplaceOne(ctx,
+		bson.M{"_id": "maintenance"},
+		state,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Bakım modu kaydedilemedi"})
+	}
+
+	maintenance.Lock()
+	maintenance.state = state
+	maintenance.Unlock()
+
+	return c.Status(fiber.StatusOK).JSON(state)
+}
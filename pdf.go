@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// A4 landscape, in points.
+const (
+	pdfPageWidth  = 842
+	pdfPageHeight = 595
+	pdfMargin     = 36
+	pdfFontSize   = 8
+	pdfTitleSize  = 14
+	pdfLineHeight = 11
+	pdfCellGap    = 6
+)
+
+var pdfFont *sfnt.Font
+
+func init() {
+	f, err := sfnt.Parse(goregular.TTF)
+	if err != nil {
+		panic(err)
+	}
+	pdfFont = f
+}
+
+// pdfText measures and encodes strings with the embedded font. Text is
+// written as two-byte glyph ids (Identity-H), so any character the font
+// covers, including ş, ğ and ı, prints correctly.
+type pdfText struct {
+	buf    sfnt.Buffer
+	glyphs map[sfnt.GlyphIndex]rune
+	widths map[sfnt.GlyphIndex]int
+}
+
+func (t *pdfText) glyph(r rune) sfnt.GlyphIndex {
+	gid, err := pdfFont.GlyphIndex(&t.buf, r)
+	if err != nil || gid == 0 {
+		gid, _ = pdfFont.GlyphIndex(&t.buf, '?')
+		r = '?'
+	}
+	if _, ok := t.widths[gid]; !ok {
+		adv, _ := pdfFont.GlyphAdvance(&t.buf, gid, fixed.I(1000), font.HintingNone)
+		t.widths[gid] = adv.Round()
+		t.glyphs[gid] = r
+	}
+	return gid
+}
+
+// width is the width of s in points at size.
+func (t *pdfText) width(s string, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		total += t.widths[t.glyph(r)]
+	}
+	return float64(total) * size / 1000
+}
+
+// fit shortens s with an ellipsis until it is at most max points wide.
+func (t *pdfText) fit(s string, size, max float64) string {
+	if t.width(s, size) <= max {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		if short := string(runes) + "…"; t.width(short, size) <= max {
+			return short
+		}
+	}
+	return ""
+}
+
+func (t *pdfText) hex(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('<')
+	for _, r := range s {
+		fmt.Fprintf(&sb, "%04X", uint16(t.glyph(r)))
+	}
+	sb.WriteByte('>')
+	return sb.String()
+}
+
+// encodePDF lays rows out as a table on A4 landscape pages, repeating the
+// first row as the header on every page. Columns get their natural width,
+// shrunk proportionally when the table is wider than the page.
+func encodePDF(title string, rows [][]string) ([]byte, error) {
+	t := &pdfText{glyphs: map[sfnt.GlyphIndex]rune{}, widths: map[sfnt.GlyphIndex]int{}}
+
+	var header [][]string
+	if len(rows) > 0 {
+		header, rows = rows[:1:1], rows[1:]
+	}
+
+	var colWidths []float64
+	for _, row := range append(header, rows...) {
+		for i, cell := range row {
+			if i >= len(colWidths) {
+				colWidths = append(colWidths, 0)
+			}
+			if w := t.width(cell, pdfFontSize) + pdfCellGap; w > colWidths[i] {
+				colWidths[i] = w
+			}
+		}
+	}
+	total := 0.0
+	for _, w := range colWidths {
+		total += w
+	}
+	if available := float64(pdfPageWidth - 2*pdfMargin); total > available {
+		for i := range colWidths {
+			colWidths[i] *= available / total
+		}
+	}
+
+	top := float64(pdfPageHeight - pdfMargin - pdfTitleSize - pdfLineHeight)
+	perPage := int((top-pdfMargin)/pdfLineHeight) - 1
+	pageCount := max(1, (len(rows)+perPage-1)/perPage)
+	var pages []string
+	for start := 0; start == 0 || start < len(rows); start += perPage {
+		end := start + perPage
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d %d Td %s Tj ET\n", pdfTitleSize, pdfMargin, pdfPageHeight-pdfMargin-pdfTitleSize, t.hex(title))
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d %d Td %s Tj ET\n", pdfFontSize, pdfPageWidth-pdfMargin-120, pdfMargin/2,
+			t.hex(fmt.Sprintf("Sayfa %d / %d", len(pages)+1, pageCount)))
+
+		y := top
+		for i, row := range append(header, rows[start:end]...) {
+			x := float64(pdfMargin)
+			for j, cell := range row {
+				if j >= len(colWidths) {
+					break
+				}
+				cell = t.fit(cell, pdfFontSize, colWidths[j]-pdfCellGap)
+				fmt.Fprintf(&content, "BT /F1 %d Tf %.2f %.2f Td %s Tj ET\n", pdfFontSize, x, y, t.hex(cell))
+				x += colWidths[j]
+			}
+			if i == 0 && len(header) > 0 {
+				fmt.Fprintf(&content, "0.5 w %d %.2f m %d %.2f l S\n", pdfMargin, y-3, pdfPageWidth-pdfMargin, y-3)
+			}
+			y -= pdfLineHeight
+		}
+		pages = append(pages, content.String())
+	}
+
+	return t.document(pages)
+}
+
+// document assembles the page content streams, the Type0 font and the
+// cross-reference table.
+func (t *pdfText) document(pages []string) ([]byte, error) {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	stream := func(dict string, data []byte) error {
+		var z bytes.Buffer
+		w := zlib.NewWriter(&z)
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		object(fmt.Sprintf("<< %s /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", dict, z.Len(), z.Bytes()))
+		return nil
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-7 are fixed; pages and their content streams follow.
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 8+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type0 /BaseFont /GoRegular /Encoding /Identity-H /DescendantFonts [4 0 R] /ToUnicode 7 0 R >>")
+
+	gids := make([]int, 0, len(t.widths))
+	for gid := range t.widths {
+		gids = append(gids, int(gid))
+	}
+	sort.Ints(gids)
+	var w strings.Builder
+	for _, gid := range gids {
+		fmt.Fprintf(&w, "%d [%d] ", gid, t.widths[sfnt.GlyphIndex(gid)])
+	}
+	object(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /GoRegular /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor 5 0 R /CIDToGIDMap /Identity /DW 600 /W [%s] >>", w.String()))
+
+	bounds, err := pdfFont.Bounds(&t.buf, fixed.I(1000), font.HintingNone)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := pdfFont.Metrics(&t.buf, fixed.I(1000), font.HintingNone)
+	if err != nil {
+		return nil, err
+	}
+	object(fmt.Sprintf("<< /Type /FontDescriptor /FontName /GoRegular /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 6 0 R >>",
+		bounds.Min.X.Round(), -bounds.Max.Y.Round(), bounds.Max.X.Round(), -bounds.Min.Y.Round(),
+		metrics.Ascent.Round(), -metrics.Descent.Round(), metrics.CapHeight.Round()))
+	if err := stream(fmt.Sprintf("/Length1 %d", len(goregular.TTF)), goregular.TTF); err != nil {
+		return nil, err
+	}
+
+	var cmap strings.Builder
+	cmap.WriteString("/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n")
+	cmap.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n/CMapName /Adobe-Identity-UCS def /CMapType 2 def\n")
+	cmap.WriteString("1 begincodespacerange <0000> <FFFF> endcodespacerange\n")
+	for i := 0; i < len(gids); i += 100 {
+		chunk := gids[i:min(i+100, len(gids))]
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", len(chunk))
+		for _, gid := range chunk {
+			fmt.Fprintf(&cmap, "<%04X> <%s>\n", gid, utf16Hex(t.glyphs[sfnt.GlyphIndex(gid)]))
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+	cmap.WriteString("endcmap CMapName currentdict /CMap defineresource pop end end")
+	if err := stream("", []byte(cmap.String())); err != nil {
+		return nil, err
+	}
+
+	for i, content := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 9+2*i))
+		if err := stream("", []byte(content)); err != nil {
+			return nil, err
+		}
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info << /Producer (library-api) /CreationDate (D:%s) >> >>\nstartxref\n%d\n%%%%EOF\n",
+		len(offsets)+1, time.Now().UTC().Format("20060102150405Z"), xref)
+	return buf.Bytes(), nil
+}
+
+func utf16Hex(r rune) string {
+	if r < 0x10000 {
+		return fmt.Sprintf("%04X", r)
+	}
+	r -= 0x10000
+	return fmt.Sprintf("%04X%04X", 0xD800+(r>>10), 0xDC00+(r&0x3FF))
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestEncodePDF(t *testing.T) {
+	rows := [][]string{loanReportHeader}
+	for i := 0; i < 90; i++ {
+		rows = append(rows, []string{"id", fmt.Sprintf("Saatleri Ayarlama Enstitüsü %d", i), "uid", "şükrü", "", "", ""})
+	}
+
+	data, err := encodePDF("Kütüphane raporu", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatal("missing PDF header or trailer")
+	}
+	if !bytes.Contains(data, []byte("/Count 3")) {
+		t.Error("90 rows should span 3 pages")
+	}
+
+	// Every xref entry must point at the start of its object.
+	m := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(data)
+	start, _ := strconv.Atoi(string(m[1]))
+	for i, off := range regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(data[start:], -1) {
+		n, _ := strconv.Atoi(string(off[1]))
+		if !bytes.HasPrefix(data[n:], []byte(fmt.Sprintf("%d 0 obj", i+1))) {
+			t.Errorf("xref entry %d points at the wrong offset", i+1)
+		}
+	}
+
+	if rows[1][1] != "Saatleri Ayarlama Enstitüsü 0" {
+		t.Error("encodePDF modified its input")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RateLimit is a token bucket: Burst tokens at most, refilled at Rate
+// tokens per second.
+type RateLimit struct {
+	Rate  float64 `bson:"rate" json:"rate"`
+	Burst int     `bson:"burst" json:"burst"`
+}
+
+var defaultRateLimits = map[string]RateLimit{
+	"search":      {Rate: 10, Burst: 60},
+	"login":       {Rate: 0.1, Burst: 5},
+	"circulation": {Rate: 1, Burst: 10},
+	"default":     {Rate: 5, Burst: 20},
+}
+
+var rateLimits = struct {
+	sync.RWMutex
+	classes map[string]RateLimit
+}{classes: copyRateLimits(defaultRateLimits)}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var buckets = struct {
+	sync.Mutex
+	m map[string]*tokenBucket
+}{m: map[string]*tokenBucket{}}
+
+func copyRateLimits(src map[string]RateLimit) map[string]RateLimit {
+	dst := make(map[string]RateLimit, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+func endpointClass(c *fiber.Ctx) string {
+	path := c.Path()
+	switch {
+	case path == "/login" || path == "/register":
+		return "login"
+	case path == "/borrow" || path == "/return":
+		return "circulation"
+	case c.Method() == fiber.MethodGet && (path == "/books" || strings.HasPrefix(path, "/book/")):
+		return "search"
+	}
+	return "default"
+}
+
+// take removes one token from the bucket for key and reports whether the
+// request may proceed, and if not how long until a token is available.
+func take(key string, limit RateLimit, now time.Time) (bool, time.Duration) {
+	buckets.Lock()
+	defer buckets.Unlock()
+
+	b, ok := buckets.m[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		buckets.m[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if limit.Rate <= 0 {
+		return false, time.Minute
+	}
+	return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
+
+func rateLimiter(c *fiber.Ctx) error {
+	class := endpointClass(c)
+
+	rateLimits.RLock()
+	limit := rateLimits.classes[class]
+	rateLimits.RUnlock()
+
+	ok, wait := take(class+"|"+c.IP(), limit, time.Now())
+	if ok {
+		return c.Next()
+	}
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Çok fazla istek, lütfen biraz bekleyin"})
+}
+
+// sweepBuckets drops buckets that have been idle long enough to be full
+// again, so the map does not grow with every client address seen.
+func sweepBuckets() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		buckets.Lock()
+		for key, b := range buckets.m {
+			if now.Sub(b.last) > 10*time.Minute {
+				delete(buckets.m, key)
+			}
+		}
+		buckets.Unlock()
+	}
+}
+
+func loadRateLimits() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var doc struct {
+		Classes map[string]RateLimit `bson:"classes"`
+	}
+	if err := settingsCollection.FindOne(ctx, bson.M{"_id": "rate_limits"}).Decode(&doc); err != nil {
+		return
+	}
+
+	rateLimits.Lock()
+	for class, limit := range doc.Classes {
+		if _, ok := defaultRateLimits[class]; ok {
+			rateLimits.classes[class] = limit
+		}
+	}
+	rateLimits.Unlock()
+}
+
+func getRateLimits(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageSystem) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	rateLimits.RLock()
+	defer rateLimits.RUnlock()
+	return c.Status(fiber.StatusOK).JSON(rateLimits.classes)
+}
+
+func setRateLimits(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageSystem) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	var body map[string]RateLimit
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz JSON"})
+	}
+	for class, limit := range body {
+		if _, ok := defaultRateLimits[class]; !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Bilinmeyen uç nokta sınıfı: " + class})
+		}
+		if limit.Rate < 0 || limit.Burst < 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "rate negatif olamaz, burst en az 1 olmalı"})
+		}
+	}
+
+	rateLimits.Lock()
+	for class, limit := range body {
+		rateLimits.classes[class] = limit
+	}
+	classes := copyRateLimits(rateLimits.classes)
+	rateLimits.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := settingsCollection.ReplaceOne(ctx,
+		bson.M{"_id": "rate_limits"},
+		bson.M{"classes": classes},
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Hız limitleri kaydedilemedi"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(classes)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestEndpointClass(t *testing.T) {
+	app := fiber.New()
+	app.All("/*", func(c *fiber.Ctx) error {
+		return c.SendString(endpointClass(c))
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"POST", "/login", "login"},
+		{"POST", "/register", "login"},
+		{"POST", "/borrow", "circulation"},
+		{"POST", "/return", "circulation"},
+		{"GET", "/books", "search"},
+		{"GET", "/book/abc", "search"},
+		{"GET", "/book/abc/wayfinding", "search"},
+		{"PATCH", "/book/abc", "default"},
+		{"POST", "/book", "default"},
+		{"GET", "/bookshelf", "default"},
+		{"GET", "/admin/rate-limits", "default"},
+	}
+
+	for _, tt := range tests {
+		res, err := app.Test(httptest.NewRequest(tt.method, tt.path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		if string(body) != tt.want {
+			t.Errorf("%s %s: class %q, want %q", tt.method, tt.path, body, tt.want)
+		}
+	}
+}
+
+func TestTake(t *testing.T) {
+	start := time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC)
+
+	type step struct {
+		after    time.Duration
+		ok       bool
+		wantWait time.Duration
+	}
+	tests := []struct {
+		name  string
+		limit RateLimit
+		steps []step
+	}{
+		{"burst then refused", RateLimit{Rate: 1, Burst: 2}, []step{
+			{0, true, 0},
+			{0, true, 0},
+			{0, false, time.Second},
+		}},
+		{"refills over time", RateLimit{Rate: 0.1, Burst: 1}, []step{
+			{0, true, 0},
+			{5 * time.Second, false, 5 * time.Second},
+			{5 * time.Second, true, 0},
+		}},
+		{"refill capped at burst", RateLimit{Rate: 10, Burst: 2}, []step{
+			{time.Hour, true, 0},
+			{0, true, 0},
+			{0, false, 100 * time.Millisecond},
+		}},
+		{"zero rate never refills", RateLimit{Rate: 0, Burst: 1}, []step{
+			{0, true, 0},
+			{time.Hour, false, time.Minute},
+		}},
+		{"zero burst", RateLimit{Rate: 1, Burst: 0}, []step{
+			{0, false, time.Second},
+		}},
+	}
+
+	for _, tt := range tests {
+		key := "test|" + tt.name
+		now := start
+		for i, s := range tt.steps {
+			now = now.Add(s.after)
+			ok, wait := take(key, tt.limit, now)
+			if ok != s.ok || wait != s.wantWait {
+				t.Errorf("%s step %d: take = %v, %s; want %v, %s", tt.name, i, ok, wait, s.ok, s.wantWait)
+			}
+		}
+	}
+
+	// Buckets are per key.
+	if ok, _ := take("test|other", RateLimit{Rate: 1, Burst: 1}, start); !ok {
+		t.Error("separate key shared a bucket")
+	}
+}
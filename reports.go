@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"log"
+	"net/mail"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ReportSubscription struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Report     string             `bson:"report" json:"report"`
+	Schedule   string             `bson:"schedule" json:"schedule"`
+	Format     string             `bson:"format" json:"format"`
+	Recipients []string           `bson:"recipients" json:"recipients"`
+	CreatedBy  primitive.ObjectID `bson:"created_by" json:"created_by"`
+	LastRunAt  *time.Time         `bson:"last_run_at,omitempty" json:"last_run_at,omitempty"`
+	NextRunAt  time.Time          `bson:"next_run_at" json:"next_run_at"`
+	LastError  string             `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	Failures   int                `bson:"failures,omitempty" json:"failures,omitempty"`
+}
+
+// reportRetryDelay backs off failed deliveries: 5 minutes after the first
+// failure, doubling up to an hour.
+func reportRetryDelay(failures int) time.Duration {
+	delay := 5 * time.Minute
+	for i := 1; i < failures && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	return min(delay, time.Hour)
+}
+
+type reportGenerator func(ctx context.Context, now time.Time) ([][]string, error)
+
+var reportGenerators = map[string]reportGenerator{
+	"weekly_circulation": circulationReport,
+	"monthly_overdue":    overdueReport,
+}
+
+var reportCacheTTL = map[string]time.Duration{
+	"weekly_circulation": 15 * time.Minute,
+	"monthly_overdue":    5 * time.Minute,
+}
+
+// cachedReport shares one report run between subscriptions that fall due
+// in the same minute; loan, book and user writes bust it. The report
+// covers a window ending at now, so the key includes the minute.
+func cachedReport(ctx context.Context, name string, now time.Time) ([][]string, error) {
+	generate := reportGenerators[name]
+	now = now.Truncate(time.Minute)
+	key := "report:" + name + ":" + strconv.FormatInt(now.Unix(), 10)
+	v, err := cachedAggregate(key, reportCacheTTL[name], []string{tagLoans, tagBooks, tagUsers}, func() (interface{}, error) {
+		return generate(ctx, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([][]string), nil
+}
+
+var loanReportHeader = []string{"book_id", "title", "user_id", "username", "borrowed_at", "due_at", "returned_at"}
+
+func circulationReport(ctx context.Context, now time.Time) ([][]string, error) {
+	since := now.AddDate(0, 0, -7)
+	return loanReportRows(ctx, bson.M{"$or": []bson.M{
+		{"borrowed_at": bson.M{"$gte": since}},
+		{"returned_at": bson.M{"$gte": since}},
+	}})
+}
+
+func overdueReport(ctx context.Context, now time.Time) ([][]string, error) {
+	return loanReportRows(ctx, bson.M{
+		"returned_at": bson.M{"$exists": false},
+		"due_at":      bson.M{"$lt": now},
+	})
+}
+
+func loanReportRows(ctx context.Context, filter bson.M) ([][]string, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sort", Value: bson.M{"borrowed_at": 1}}},
+		{{Key: "$lookup", Value: bson.M{"from": "books", "localField": "book_id", "foreignField": "_id", "as": "book"}}},
+		{{Key: "$lookup", Value: bson.M{"from": "users", "localField": "user_id", "foreignField": "_id", "as": "user"}}},
+	}
+
+	cursor, err := loanCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Loan `bson:",inline"`
+		Book []Book `bson:"book"`
+		User []User `bson:"user"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	rows := [][]string{loanReportHeader}
+	for _, r := range results {
+		title, username, returned := "", "", ""
+		if len(r.Book) > 0 {
+			title = r.Book[0].Title
+		}
+		if len(r.User) > 0 {
+			username = r.User[0].Username
+		}
+		if r.ReturnedAt != nil {
+			returned = r.ReturnedAt.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{
+			r.BookID.Hex(), title, r.UserID.Hex(), username,
+			r.BorrowedAt.Format(time.RFC3339), r.DueAt.Format(time.RFC3339), returned,
+		})
+	}
+	return rows, nil
+}
+
+func encodeCSV(rows [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func createReportSubscription(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageReports) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	type request struct {
+		Report     string   `json:"report"`
+		Schedule   string   `json:"schedule"`
+		Format     string   `json:"format"`
+		Recipients []string `json:"recipients"`
+	}
+	var body request
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz JSON"})
+	}
+	if _, ok := reportGenerators[body.Report]; !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Bilinmeyen rapor"})
+	}
+	if body.Format == "" {
+		body.Format = "csv"
+	}
+	if body.Format != "csv" && body.Format != "pdf" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "format csv veya pdf olmalı"})
+	}
+	schedule, err := parseCron(body.Schedule)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	next := schedule.next(time.Now())
+	if next.IsZero() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Zamanlama hiçbir zaman çalışmıyor"})
+	}
+	if len(body.Recipients) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "En az bir alıcı gerekli"})
+	}
+	for _, r := range body.Recipients {
+		if _, err := mail.ParseAddress(r); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz e-posta adresi: " + r})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub := ReportSubscription{
+		Report:     body.Report,
+		Schedule:   body.Schedule,
+		Format:     body.Format,
+		Recipients: body.Recipients,
+		CreatedBy:  currentActor(c).ID,
+		NextRunAt:  next,
+	}
+
+	res, err := reportSubscriptionCollection.InsertOne(ctx, sub)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Abonelik eklenemedi"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"inserted_id": res.InsertedID, "next_run_at": next})
+}
+
+func listReportSubscriptions(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageReports) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := reportSubscriptionCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Abonelikler alınamadı"})
+	}
+	defer cursor.Close(ctx)
+
+	subs := []ReportSubscription{}
+	if err := cursor.All(ctx, &subs); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Abonelikler parse edilemedi"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(subs)
+}
+
+func deleteReportSubscription(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageReports) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz abonelik ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := reportSubscriptionCollection.DeleteOne(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Abonelik silinemedi"})
+	}
+	if res.DeletedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Abonelik bulunamadı"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Abonelik silindi"})
+}
+
+func runReportScheduler() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		runDueReports(now)
+	}
+}
+
+func runDueReports(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cursor, err := reportSubscriptionCollection.Find(ctx, bson.M{"next_run_at": bson.M{"$lte": now}})
+	if err != nil {
+		log.Println("Rapor abonelikleri alınamadı:", err)
+		return
+	}
+	var subs []ReportSubscription
+	if err := cursor.All(ctx, &subs); err != nil {
+		log.Println("Rapor abonelikleri parse edilemedi:", err)
+		return
+	}
+
+	for _, sub := range subs {
+		var update bson.M
+		if err := deliverReport(ctx, sub, now); err != nil {
+			// Stay due and retry rather than skipping this period's report.
+			log.Printf("Rapor gönderilemedi (%s): %v", sub.ID.Hex(), err)
+			update = bson.M{
+				"$set": bson.M{"last_error": err.Error(), "next_run_at": now.Add(reportRetryDelay(sub.Failures + 1))},
+				"$inc": bson.M{"failures": 1},
+			}
+		} else {
+			set := bson.M{"last_run_at": now}
+			if schedule, err := parseCron(sub.Schedule); err == nil {
+				set["next_run_at"] = schedule.next(now)
+			}
+			update = bson.M{"$set": set, "$unset": bson.M{"last_error": "", "failures": ""}}
+		}
+		if _, err := reportSubscriptionCollection.UpdateOne(ctx, bson.M{"_id": sub.ID}, update); err != nil {
+			log.Printf("Rapor aboneliği güncellenemedi (%s): %v", sub.ID.Hex(), err)
+		}
+	}
+}
+
+func deliverReport(ctx context.Context, sub ReportSubscription, now time.Time) error {
+	if _, ok := reportGenerators[sub.Report]; !ok {
+		return nil
+	}
+
+	rows, err := cachedReport(ctx, sub.Report, now)
+	if err != nil {
+		return err
+	}
+	title := "Kütüphane raporu: " + sub.Report
+	file := attachment{Name: sub.Report + "-" + now.Format("2006-01-02") + "." + sub.Format}
+	switch sub.Format {
+	case "pdf":
+		file.ContentType = "application/pdf"
+		file.Data, err = encodePDF(title+" ("+now.Format("02.01.2006")+")", rows)
+	default:
+		file.ContentType = "text/csv; charset=utf-8"
+		file.Data, err = encodeCSV(rows)
+	}
+	if err != nil {
+		return err
+	}
+
+	return sendMail(sub.Recipients, title, "Ekte planlanmış raporunuzu bulabilirsiniz.", file)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RetentionPolicy controls when dormant patron accounts are anonymized:
+// patrons inactive for InactiveYears are notified NoticeDays in advance
+// and anonymized once the notice period passes without activity.
+// InactiveYears of zero, the default, disables the policy.
+type RetentionPolicy struct {
+	InactiveYears int `json:"inactive_years"`
+	NoticeDays    int `json:"notice_days"`
+}
+
+var retentionPolicy = defaultConfig.Retention
+
+// RetentionResult lists the accounts a run touched. Failed notices are
+// retried on the next run; accounts without an email address cannot be
+// notified and are never anonymized automatically.
+type RetentionResult struct {
+	DryRun     bool                 `json:"dry_run"`
+	Notified   []primitive.ObjectID `json:"notified"`
+	Failed     []primitive.ObjectID `json:"failed"`
+	NoEmail    []primitive.ObjectID `json:"no_email"`
+	Anonymized []primitive.ObjectID `json:"anonymized"`
+}
+
+type UpcomingExpiration struct {
+	UserID     primitive.ObjectID `json:"user_id"`
+	Username   string             `json:"username"`
+	LastActive time.Time          `json:"last_active"`
+	ExpiresAt  time.Time          `json:"expires_at"`
+	Notified   bool               `json:"notified"`
+	HasEmail   bool               `json:"has_email"`
+}
+
+// lastActivity falls back to the account creation time, taken from the
+// ObjectID, for users created before activity was tracked.
+func (u *User) lastActivity() time.Time {
+	if u.LastActiveAt != nil {
+		return *u.LastActiveAt
+	}
+	return u.ID.Timestamp()
+}
+
+func (p RetentionPolicy) expiresAt(lastActive time.Time) time.Time {
+	return lastActive.AddDate(p.InactiveYears, 0, 0)
+}
+
+// touchUser records activity and cancels any pending dormancy notice.
+func touchUser(ctx context.Context, userID primitive.ObjectID) {
+	_, err := userCollection.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{
+			"$set":   bson.M{"last_active_at": time.Now()},
+			"$unset": bson.M{"dormant_notified_at": ""},
+		},
+	)
+	if err != nil {
+		log.Println("Kullanıcı etkinliği kaydedilemedi:", err)
+	}
+}
+
+// dormantFilter matches active-role patrons with nothing on loan whose
+// last activity is before cutoff.
+func dormantFilter(cutoff time.Time) bson.M {
+	return bson.M{
+		"anonymized_at": bson.M{"$exists": false},
+		"role":          bson.M{"$in": []interface{}{RolePatron, nil}},
+		"books.0":       bson.M{"$exists": false},
+		"$or": []bson.M{
+			{"last_active_at": bson.M{"$lt": cutoff}},
+			{"last_active_at": bson.M{"$exists": false}, "_id": bson.M{"$lt": primitive.NewObjectIDFromTimestamp(cutoff)}},
+		},
+	}
+}
+
+func findUsersBy(ctx context.Context, filter bson.M) ([]User, error) {
+	cursor, err := userCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var users []User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// runRetention applies policy as of now. With dryRun it only reports the
+// accounts it would notify and anonymize.
+func runRetention(ctx context.Context, policy RetentionPolicy, now time.Time, dryRun bool) (*RetentionResult, error) {
+	result := &RetentionResult{
+		DryRun:     dryRun,
+		Notified:   []primitive.ObjectID{},
+		Failed:     []primitive.ObjectID{},
+		NoEmail:    []primitive.ObjectID{},
+		Anonymized: []primitive.ObjectID{},
+	}
+	if policy.InactiveYears <= 0 {
+		return result, nil
+	}
+	expiryCutoff := now.AddDate(-policy.InactiveYears, 0, 0)
+	noticeCutoff := expiryCutoff.AddDate(0, 0, policy.NoticeDays)
+
+	filter := dormantFilter(noticeCutoff)
+	filter["dormant_notified_at"] = bson.M{"$exists": false}
+	toNotify, err := findUsersBy(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range toNotify {
+		if u.Email == "" {
+			result.NoEmail = append(result.NoEmail, u.ID)
+			continue
+		}
+		if dryRun {
+			result.Notified = append(result.Notified, u.ID)
+			continue
+		}
+		expires := policy.expiresAt(u.lastActivity())
+		if expires.Before(now.AddDate(0, 0, policy.NoticeDays)) {
+			expires = now.AddDate(0, 0, policy.NoticeDays)
+		}
+		err := sendMail([]string{u.Email},
+			"Kütüphane hesabınız kapatılacak",
+			"Merhaba "+u.Username+",\n\nKütüphane hesabınız uzun süredir kullanılmıyor. "+
+				expires.Format("02.01.2006")+" tarihine kadar giriş yapmazsanız kişisel bilgileriniz silinecektir.",
+		)
+		if err != nil {
+			log.Printf("Hesap kapatma bildirimi gönderilemedi (%s): %v", u.ID.Hex(), err)
+			result.Failed = append(result.Failed, u.ID)
+			continue
+		}
+		if _, err := userCollection.UpdateOne(ctx, bson.M{"_id": u.ID}, bson.M{"$set": bson.M{"dormant_notified_at": now}}); err != nil {
+			return result, err
+		}
+		result.Notified = append(result.Notified, u.ID)
+	}
+
+	filter = dormantFilter(expiryCutoff)
+	filter["dormant_notified_at"] = bson.M{"$lte": now.AddDate(0, 0, -policy.NoticeDays)}
+	toAnonymize, err := findUsersBy(ctx, filter)
+	if err != nil {
+		return result, err
+	}
+	for _, u := range toAnonymize {
+		if dryRun {
+			result.Anonymized = append(result.Anonymized, u.ID)
+			continue
+		}
+		if err := anonymizeUser(ctx, &u, now); err != nil {
+			return result, err
+		}
+		result.Anonymized = append(result.Anonymized, u.ID)
+	}
+
+	return result, nil
+}
+
+// anonymizeUser strips personal data but keeps the document so loan
+// history stays consistent.
+func anonymizeUser(ctx context.Context, u *User, now time.Time) error {
+	if u.PhotoUpdatedAt != nil {
+		if err := blobStore.Delete(ctx, photoKey(u.ID)); err != nil {
+			return err
+		}
+	}
+	_, err := userCollection.UpdateOne(ctx,
+		bson.M{"_id": u.ID},
+		bson.M{
+			"$set":   bson.M{"username": "anonim-" + u.ID.Hex(), "anonymized_at": now},
+			"$unset": bson.M{"password": "", "email": "", "photo_updated_at": "", "dormant_notified_at": ""},
+		},
+	)
+	bustAggregates(tagUsers)
+	return err
+}
+
+// The policy runs once a day. The time of the last run is kept in settings
+// and checked every hour, starting at startup, so restarts neither skip
+// nor repeat a day.
+const (
+	retentionInterval      = 24 * time.Hour
+	retentionCheckInterval = time.Hour
+)
+
+// claimRetentionRun records now as the last run if the previous one is at
+// least retentionInterval old. Only one instance wins the claim.
+func claimRetentionRun(ctx context.Context, now time.Time) (bool, error) {
+	_, err := settingsCollection.UpdateOne(ctx,
+		bson.M{"_id": "retention", "last_run_at": bson.M{"$not": bson.M{"$gt": now.Add(-retentionInterval)}}},
+		bson.M{"$set": bson.M{"last_run_at": now}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func runRetentionJob() {
+	ticker := time.NewTicker(retentionCheckInterval)
+	defer ticker.Stop()
+
+	for now := time.Now(); ; now = <-ticker.C {
+		if retentionPolicy.InactiveYears > 0 {
+			runRetentionIfDue(now)
+		}
+	}
+}
+
+func runRetentionIfDue(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	due, err := claimRetentionRun(ctx, now)
+	if err != nil {
+		log.Println("Saklama politikası zamanı okunamadı:", err)
+		return
+	}
+	if !due {
+		return
+	}
+
+	result, err := runRetention(ctx, retentionPolicy, now, false)
+	if err != nil {
+		log.Println("Saklama politikası uygulanamadı:", err)
+		// Let the next hourly check try again.
+		settingsCollection.UpdateOne(ctx, bson.M{"_id": "retention"}, bson.M{"$unset": bson.M{"last_run_at": ""}})
+		return
+	}
+	log.Printf("Saklama politikası: %d bildirim, %d başarısız bildirim, %d anonimleştirme", len(result.Notified), len(result.Failed), len(result.Anonymized))
+}
+
+func upcomingExpirations(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageUsers) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	if retentionPolicy.InactiveYears <= 0 {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"policy": retentionPolicy, "users": []UpcomingExpiration{}})
+	}
+
+	days := c.QueryInt("days", 90)
+	now := time.Now()
+	cutoff := now.AddDate(-retentionPolicy.InactiveYears, 0, days)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := userCollection.Find(ctx, dormantFilter(cutoff), options.Find().SetProjection(bson.M{"password": 0}))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kullanıcılar alınamadı"})
+	}
+	var users []User
+	if err := cursor.All(ctx, &users); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kullanıcılar parse edilemedi"})
+	}
+
+	report := make([]UpcomingExpiration, 0, len(users))
+	for _, u := range users {
+		last := u.lastActivity()
+		report = append(report, UpcomingExpiration{
+			UserID:     u.ID,
+			Username:   u.Username,
+			LastActive: last,
+			ExpiresAt:  retentionPolicy.expiresAt(last),
+			Notified:   u.DormantNotifiedAt != nil,
+			HasEmail:   u.Email != "",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"policy": retentionPolicy, "users": report})
+}
+
+func runRetentionNow(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageUsers) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	result, err := runRetention(ctx, retentionPolicy, time.Now(), c.QueryBool("dry_run"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Saklama politikası uygulanamadı"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
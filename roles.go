@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Role string
+
+const (
+	RolePatron      Role = "patron"
+	RoleCirculation Role = "circulation"
+	RoleAdmin       Role = "admin"
+)
+
+type Permission string
+
+const (
+	PermViewCurrentLoans Permission = "loans:current"
+	PermViewLoanHistory  Permission = "loans:history"
+	PermManageUsers      Permission = "users:manage"
+	PermManageReports    Permission = "reports:manage"
+	PermManageSystem     Permission = "system:manage"
+	PermManageILL        Permission = "ill:manage"
+	PermManageCatalog    Permission = "catalog:manage"
+	PermCirculate        Permission = "loans:circulate"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RolePatron:      {},
+	RoleCirculation: {PermViewCurrentLoans, PermManageILL, PermManageCatalog, PermCirculate},
+	RoleAdmin:       {PermViewCurrentLoans, PermViewLoanHistory, PermManageUsers, PermManageReports, PermManageSystem, PermManageILL, PermManageCatalog, PermCirculate},
+}
+
+func (r Role) valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+func (u *User) role() Role {
+	if u.Role == "" {
+		return RolePatron
+	}
+	return u.Role
+}
+
+func (u *User) can(p Permission) bool {
+	for _, granted := range rolePermissions[u.role()] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// loadActor resolves the session token in the Authorization header to the
+// acting user. Requests without the header are anonymous.
+func loadActor(c *fiber.Ctx) error {
+	auth := c.Get(fiber.HeaderAuthorization)
+	if auth == "" {
+		return c.Next()
+	}
+
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Geçersiz oturum"})
+	}
+	objID, err := verifySessionToken(token, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Geçersiz ya da süresi dolmuş oturum"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var actor User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&actor); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Kullanıcı doğrulanamadı"})
+	}
+	if actor.AnonymizedAt != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Hesap anonimleştirilmiş"})
+	}
+
+	c.Locals("actor", &actor)
+	return c.Next()
+}
+
+func currentActor(c *fiber.Ctx) *User {
+	actor, _ := c.Locals("actor").(*User)
+	return actor
+}
+
+// authorize reports whether the acting user may access the records of
+// target, either because they are the same user or because their role
+// grants p.
+func authorize(c *fiber.Ctx, target primitive.ObjectID, p Permission) bool {
+	actor := currentActor(c)
+	if actor == nil {
+		return false
+	}
+	return actor.ID == target || actor.can(p)
+}
+
+func hasPermission(c *fiber.Ctx, p Permission) bool {
+	actor := currentActor(c)
+	return actor != nil && actor.can(p)
+}
+
+// redactBorrower hides who holds a book unless the actor is the borrower
+// or may see current loans; everyone still sees whether it is available.
+func redactBorrower(c *fiber.Ctx, b *Book) {
+	b.Available = b.BorrowerID == nil
+	if b.BorrowerID != nil && !authorize(c, *b.BorrowerID, PermViewCurrentLoans) {
+		b.BorrowerID = nil
+	}
+}
+
+func setUserRole(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageUsers) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz kullanıcı ID"})
+	}
+
+	type request struct {
+		Role Role `json:"role"`
+	}
+	var body request
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz JSON"})
+	}
+	if !body.Role.valid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz rol"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := userCollection.UpdateOne(ctx,
+		bson.M{"_id": objID},
+		bson.M{"$set": bson.M{"role": body.Role}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kullanıcı güncellenemedi"})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kullanıcı bulunamadı"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Rol güncellendi"})
+}
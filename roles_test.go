@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// useTestDatabase points the collections at a fresh database on
+// LIBRARY_TEST_MONGO_URI and skips the test when it is not set.
+func useTestDatabase(t *testing.T) {
+	t.Helper()
+	uri := os.Getenv("LIBRARY_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("LIBRARY_TEST_MONGO_URI tanımlı değil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := client.Database("library_test_" + primitive.NewObjectID().Hex())
+	initCollections(db)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		db.Drop(ctx)
+		client.Disconnect(ctx)
+	})
+}
+
+func TestRolePermissions(t *testing.T) {
+	perms := []Permission{PermViewCurrentLoans, PermViewLoanHistory, PermManageUsers}
+	tests := []struct {
+		role Role
+		want map[Permission]bool
+	}{
+		{RolePatron, map[Permission]bool{}},
+		{RoleCirculation, map[Permission]bool{PermViewCurrentLoans: true}},
+		{RoleAdmin, map[Permission]bool{PermViewCurrentLoans: true, PermViewLoanHistory: true, PermManageUsers: true}},
+		{"", map[Permission]bool{}},
+		{"librarian", map[Permission]bool{}},
+	}
+
+	for _, tt := range tests {
+		u := &User{Role: tt.role}
+		for _, p := range perms {
+			if got := u.can(p); got != tt.want[p] {
+				t.Errorf("role %q can(%s) = %v, want %v", tt.role, p, got, tt.want[p])
+			}
+		}
+	}
+
+	if Role("librarian").valid() || !RoleCirculation.valid() {
+		t.Error("valid() does not match rolePermissions")
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	self := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+	perms := []Permission{PermViewCurrentLoans, PermViewLoanHistory, PermManageUsers}
+
+	tests := []struct {
+		name  string
+		actor *User
+		want  map[Permission]bool
+	}{
+		{"anonymous", nil, map[Permission]bool{}},
+		{"self", &User{ID: self, Role: RolePatron}, map[Permission]bool{PermViewCurrentLoans: true, PermViewLoanHistory: true, PermManageUsers: true}},
+		{"patron", &User{ID: other, Role: RolePatron}, map[Permission]bool{}},
+		{"circulation", &User{ID: other, Role: RoleCirculation}, map[Permission]bool{PermViewCurrentLoans: true}},
+		{"admin", &User{ID: other, Role: RoleAdmin}, map[Permission]bool{PermViewCurrentLoans: true, PermViewLoanHistory: true, PermManageUsers: true}},
+	}
+
+	for _, tt := range tests {
+		for _, p := range perms {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				if tt.actor != nil {
+					c.Locals("actor", tt.actor)
+				}
+				if authorize(c, self, p) {
+					return c.SendStatus(fiber.StatusOK)
+				}
+				return c.SendStatus(fiber.StatusForbidden)
+			})
+
+			res, err := app.Test(httptest.NewRequest("GET", "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := res.StatusCode == fiber.StatusOK; got != tt.want[p] {
+				t.Errorf("%s authorize(%s) = %v, want %v", tt.name, p, got, tt.want[p])
+			}
+		}
+	}
+}
+
+func newUserTestApp(actor *User) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if actor != nil {
+			c.Locals("actor", actor)
+		}
+		return c.Next()
+	})
+	app.Get("/user/:id", getUser)
+	app.Get("/user/:id/loans", getUserLoans)
+	return app
+}
+
+func TestUserEndpointsForbidden(t *testing.T) {
+	target := primitive.NewObjectID().Hex()
+	other := primitive.NewObjectID()
+
+	tests := []struct {
+		name  string
+		actor *User
+		path  string
+	}{
+		{"anonymous record", nil, "/user/" + target},
+		{"patron record", &User{ID: other, Role: RolePatron}, "/user/" + target},
+		{"anonymous loans", nil, "/user/" + target + "/loans"},
+		{"patron loans", &User{ID: other, Role: RolePatron}, "/user/" + target + "/loans"},
+		{"circulation loans", &User{ID: other, Role: RoleCirculation}, "/user/" + target + "/loans"},
+	}
+
+	for _, tt := range tests {
+		res, err := newUserTestApp(tt.actor).Test(httptest.NewRequest("GET", tt.path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != fiber.StatusForbidden {
+			t.Errorf("%s: status %d, want 403", tt.name, res.StatusCode)
+		}
+	}
+}
+
+func TestCirculationForbidden(t *testing.T) {
+	patron := primitive.NewObjectID().Hex()
+	book := primitive.NewObjectID().Hex()
+	other := primitive.NewObjectID()
+
+	tests := []struct {
+		name  string
+		actor *User
+	}{
+		{"anonymous", nil},
+		{"other patron", &User{ID: other, Role: RolePatron}},
+	}
+
+	for _, tt := range tests {
+		app := fiber.New()
+		app.Use(func(c *fiber.Ctx) error {
+			if tt.actor != nil {
+				c.Locals("actor", tt.actor)
+			}
+			return c.Next()
+		})
+		app.Post("/borrow", borrowBook)
+		app.Post("/return", returnBook)
+
+		for _, path := range []string{"/borrow", "/return"} {
+			req := httptest.NewRequest("POST", path, strings.NewReader(`{"user_id":"`+patron+`","book_id":"`+book+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != fiber.StatusForbidden {
+				t.Errorf("%s %s: status %d, want 403", tt.name, path, res.StatusCode)
+			}
+		}
+	}
+}
+
+func TestUserEndpointsAllowed(t *testing.T) {
+	useTestDatabase(t)
+
+	ctx := context.Background()
+	target := User{ID: primitive.NewObjectID(), Username: "okur", Books: []primitive.ObjectID{}, Role: RolePatron}
+	if _, err := userCollection.InsertOne(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	other := primitive.NewObjectID()
+
+	tests := []struct {
+		name  string
+		actor *User
+		path  string
+	}{
+		{"self record", &target, "/user/" + target.ID.Hex()},
+		{"self loans", &target, "/user/" + target.ID.Hex() + "/loans"},
+		{"circulation record", &User{ID: other, Role: RoleCirculation}, "/user/" + target.ID.Hex()},
+		{"admin record", &User{ID: other, Role: RoleAdmin}, "/user/" + target.ID.Hex()},
+		{"admin loans", &User{ID: other, Role: RoleAdmin}, "/user/" + target.ID.Hex() + "/loans"},
+	}
+
+	for _, tt := range tests {
+		res, err := newUserTestApp(tt.actor).Test(httptest.NewRequest("GET", tt.path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != fiber.StatusOK {
+			t.Errorf("%s: status %d, want 200", tt.name, res.StatusCode)
+		}
+	}
+}
+
+func TestLoadActor(t *testing.T) {
+	sessionSecret = []byte("test-secret")
+
+	app := fiber.New()
+	app.Use(loadActor)
+	app.Get("/", func(c *fiber.Ctx) error {
+		if currentActor(c) == nil {
+			return c.SendString("anonymous")
+		}
+		return c.SendString(currentActor(c).Username)
+	})
+
+	forged := primitive.NewObjectID().Hex() + "." + "9999999999" + ".AAAA"
+	for _, auth := range []string{"Bearer " + forged, "Basic abc", "Bearer "} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", auth)
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != fiber.StatusUnauthorized {
+			t.Errorf("Authorization %q: status %d, want 401", auth, res.StatusCode)
+		}
+	}
+
+	res, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != fiber.StatusOK {
+		t.Errorf("anonymous: status %d, want 200", res.StatusCode)
+	}
+
+	useTestDatabase(t)
+	user := User{ID: primitive.NewObjectID(), Username: "gorevli", Role: RoleCirculation}
+	if _, err := userCollection.InsertOne(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+issueSessionToken(user.ID, time.Now()))
+	res, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body [16]byte
+	n, _ := res.Body.Read(body[:])
+	if res.StatusCode != fiber.StatusOK || string(body[:n]) != user.Username {
+		t.Errorf("valid token: status %d body %q", res.StatusCode, body[:n])
+	}
+	userCollection.DeleteOne(context.Background(), bson.M{"_id": user.ID})
+
+	now := time.Now()
+	anonymized := User{ID: primitive.NewObjectID(), Username: "anonim", AnonymizedAt: &now}
+	if _, err := userCollection.InsertOne(context.Background(), anonymized); err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+issueSessionToken(anonymized.ID, now))
+	res, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("anonymized user: status %d, want 401", res.StatusCode)
+	}
+}
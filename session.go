@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const sessionTTL = 24 * time.Hour
+
+// sessionSecret signs session tokens. It comes from session_secret in the
+// config; without one a random key is used and sessions end on restart.
+var sessionSecret []byte
+
+var errInvalidSession = errors.New("geçersiz oturum")
+
+func randomSessionSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// issueSessionToken returns "<user id>.<expiry>.<signature>", where the
+// signature is an HMAC-SHA256 over the first two parts.
+func issueSessionToken(userID primitive.ObjectID, now time.Time) string {
+	payload := userID.Hex() + "." + strconv.FormatInt(now.Add(sessionTTL).Unix(), 10)
+	return payload + "." + signSession(payload)
+}
+
+func verifySessionToken(token string, now time.Time) (primitive.ObjectID, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return primitive.NilObjectID, errInvalidSession
+	}
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(signSession(payload))) {
+		return primitive.NilObjectID, errInvalidSession
+	}
+
+	id, expiry, ok := strings.Cut(payload, ".")
+	if !ok {
+		return primitive.NilObjectID, errInvalidSession
+	}
+	exp, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || now.Unix() >= exp {
+		return primitive.NilObjectID, errInvalidSession
+	}
+	return primitive.ObjectIDFromHex(id)
+}
+
+func signSession(payload string) string {
+	mac := hmac.New(sha256.New, sessionSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSessionToken(t *testing.T) {
+	sessionSecret = []byte("test-secret")
+	id := primitive.NewObjectID()
+	now := time.Now()
+	token := issueSessionToken(id, now)
+
+	got, err := verifySessionToken(token, now)
+	if err != nil || got != id {
+		t.Fatalf("verify = %v, %v; want %v", got, err, id)
+	}
+
+	if _, err := verifySessionToken(token, now.Add(sessionTTL)); err == nil {
+		t.Error("expired token accepted")
+	}
+
+	other := primitive.NewObjectID().Hex()
+	tampered := other + token[len(other):]
+	if _, err := verifySessionToken(tampered, now); err == nil {
+		t.Error("token with swapped user id accepted")
+	}
+
+	sessionSecret = []byte("another-secret")
+	if _, err := verifySessionToken(token, now); err == nil {
+		t.Error("token signed with another secret accepted")
+	}
+
+	for _, bad := range []string{"", "abc", "a.b", "a.b.c"} {
+		if _, err := verifySessionToken(bad, now); err == nil {
+			t.Errorf("malformed token %q accepted", bad)
+		}
+	}
+}
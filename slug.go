@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/text/unicode/norm"
+)
+
+// slugify turns a title into a lowercase ASCII slug, e.g.
+// "Suç ve Ceza" -> "suc-ve-ceza".
+func slugify(title string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range norm.NFD.String(strings.ToLowerSpecial(unicode.TurkishCase, title)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case r == 'ı':
+			r = 'i'
+		}
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			sb.WriteRune(r)
+			dash = false
+		} else if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+
+	slug := strings.TrimSuffix(sb.String(), "-")
+	if slug == "" {
+		slug = "kitap"
+	}
+	return slug
+}
+
+// uniqueSlug returns a slug for title not used, currently or previously,
+// by any book other than self.
+func uniqueSlug(ctx context.Context, title string, self primitive.ObjectID) (string, error) {
+	base := slugify(title)
+	for n := 1; ; n++ {
+		slug := base
+		if n > 1 {
+			slug = base + "-" + strconv.Itoa(n)
+		}
+
+		count, err := bookCollection.CountDocuments(ctx, bson.M{
+			"_id": bson.M{"$ne": self},
+			"$or": []bson.M{{"slug": slug}, {"previous_slugs": slug}},
+		})
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return slug, nil
+		}
+	}
+}
+
+func updateBook(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageCatalog) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	bookObjID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz kitap ID"})
+	}
+
+	type request struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+	}
+	var body request
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz JSON"})
+	}
+	if body.Title != nil && strings.TrimSpace(*body.Title) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "title boş olamaz"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var book Book
+	if err := bookCollection.FindOne(ctx, bson.M{"_id": bookObjID}).Decode(&book); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kitap bulunamadı"})
+	}
+
+	set := bson.M{}
+	update := bson.M{"$set": set}
+	if body.Description != nil {
+		set["description"] = *body.Description
+	}
+	if body.Title != nil && *body.Title != book.Title {
+		slug, err := uniqueSlug(ctx, *body.Title, bookObjID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Veritabanı hatası"})
+		}
+		set["title"] = *body.Title
+		set["slug"] = slug
+		// Keep the old slug so shared links redirect to the new one.
+		if book.Slug != "" && book.Slug != slug {
+			update["$addToSet"] = bson.M{"previous_slugs": book.Slug}
+		}
+	}
+	if len(set) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Güncellenecek alan yok"})
+	}
+
+	if _, err := bookCollection.UpdateOne(ctx, bson.M{"_id": bookObjID}, update); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kitap güncellenemedi"})
+	}
+	bustAggregates(tagBooks)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Kitap güncellendi", "slug": set["slug"]})
+}
+
+var catalogPage = template.Must(template.New("catalog").Parse(`<!DOCTYPE html>
+<html lang="{{.Book.Language}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Book.Title}}</title>
+<link rel="canonical" href="{{.URL}}">
+<meta property="og:type" content="book">
+<meta property="og:title" content="{{.Book.Title}}">
+<meta property="og:url" content="{{.URL}}">
+<meta property="og:locale" content="{{.Book.Language}}">
+{{if .Book.Description}}<meta property="og:description" content="{{.Book.Description}}">
+<meta name="description" content="{{.Book.Description}}">
+{{end}}<meta name="twitter:card" content="summary">
+</head>
+<body>
+<h1>{{.Book.Title}}</h1>
+{{if .Book.Description}}<p>{{.Book.Description}}</p>
+{{end}}<p>{{if .Book.Available}}Rafta mevcut{{else}}Şu anda ödünçte{{with .Book.EstimatedAvailableAt}} (tahmini dönüş: {{.Format "02.01.2006"}}){{end}}{{end}}</p>
+</body>
+</html>
+`))
+
+func catalogBook(c *fiber.Ctx) error {
+	slug := c.Params("slug")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var book Book
+	err := bookCollection.FindOne(ctx, bson.M{"$or": []bson.M{{"slug": slug}, {"previous_slugs": slug}}}).Decode(&book)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kitap bulunamadı"})
+	}
+	if book.Slug != slug {
+		return c.Redirect("/catalog/"+book.Slug, fiber.StatusMovedPermanently)
+	}
+	estimate, err := estimateAvailability(ctx, &book)
+	if err != nil {
+		log.Println("Tahmini müsaitlik hesaplanamadı:", err)
+	}
+	book.EstimatedAvailableAt = estimate
+
+	book = book.localized(c.Get(fiber.HeaderAcceptLanguage))
+	redactBorrower(c, &book)
+	c.Vary(fiber.HeaderAccept, fiber.HeaderAcceptLanguage)
+	c.Set(fiber.HeaderContentLanguage, book.Language)
+
+	if c.Accepts(fiber.MIMETextHTML, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON {
+		return c.Status(fiber.StatusOK).JSON(book)
+	}
+
+	var sb strings.Builder
+	err = catalogPage.Execute(&sb, struct {
+		Book Book
+		URL  string
+	}{book, c.BaseURL() + "/catalog/" + book.Slug})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Sayfa oluşturulamadı"})
+	}
+
+	c.Type("html", "utf-8")
+	return c.Status(fiber.StatusOK).SendString(sb.String())
+}
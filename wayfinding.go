@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type FloorMap struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Branch string             `bson:"branch" json:"branch"`
+	Floor  int                `bson:"floor" json:"floor"`
+	Width  float64            `bson:"width" json:"width"`
+	Height float64            `bson:"height" json:"height"`
+	Zones  []Zone             `bson:"zones" json:"zones"`
+}
+
+type Zone struct {
+	Code    string  `bson:"code" json:"code"`
+	Name    string  `bson:"name" json:"name"`
+	X       float64 `bson:"x" json:"x"`
+	Y       float64 `bson:"y" json:"y"`
+	Width   float64 `bson:"width" json:"width"`
+	Height  float64 `bson:"height" json:"height"`
+	Shelves []Shelf `bson:"shelves" json:"shelves"`
+}
+
+type Shelf struct {
+	Code string  `bson:"code" json:"code"`
+	X    float64 `bson:"x" json:"x"`
+	Y    float64 `bson:"y" json:"y"`
+}
+
+type ShelfLocation struct {
+	Branch string `bson:"branch" json:"branch"`
+	Floor  int    `bson:"floor" json:"floor"`
+	Zone   string `bson:"zone" json:"zone"`
+	Shelf  string `bson:"shelf" json:"shelf"`
+}
+
+func (m *FloorMap) findShelf(zoneCode, shelfCode string) (*Zone, *Shelf) {
+	for i := range m.Zones {
+		if m.Zones[i].Code != zoneCode {
+			continue
+		}
+		for j := range m.Zones[i].Shelves {
+			if m.Zones[i].Shelves[j].Code == shelfCode {
+				return &m.Zones[i], &m.Zones[i].Shelves[j]
+			}
+		}
+		return &m.Zones[i], nil
+	}
+	return nil, nil
+}
+
+func saveFloorMap(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageCatalog) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	var body FloorMap
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz JSON"})
+	}
+	if body.Branch == "" || body.Width <= 0 || body.Height <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "branch, width ve height zorunlu"})
+	}
+	if body.Zones == nil {
+		body.Zones = []Zone{}
+	}
+	body.ID = primitive.NilObjectID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := floorMapCollection.ReplaceOne(ctx,
+		bson.M{"branch": body.Branch, "floor": body.Floor},
+		body,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kat planı kaydedilemedi"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Kat planı kaydedildi"})
+}
+
+func setBookLocation(c *fiber.Ctx) error {
+	if !hasPermission(c, PermManageCatalog) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Bu işlem için yetkiniz yok"})
+	}
+
+	bookObjID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz kitap ID"})
+	}
+
+	var body ShelfLocation
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz JSON"})
+	}
+	if body.Branch == "" || body.Zone == "" || body.Shelf == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "branch, zone ve shelf zorunlu"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var floorMap FloorMap
+	if err := floorMapCollection.FindOne(ctx, bson.M{"branch": body.Branch, "floor": body.Floor}).Decode(&floorMap); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kat planı bulunamadı"})
+	}
+	if _, shelf := floorMap.findShelf(body.Zone, body.Shelf); shelf == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Raf kat planında tanımlı değil"})
+	}
+
+	res, err := bookCollection.UpdateOne(ctx,
+		bson.M{"_id": bookObjID},
+		bson.M{"$set": bson.M{"location": body}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Kitap güncellenemedi"})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kitap bulunamadı"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Kitap konumu güncellendi"})
+}
+
+func bookWayfinding(c *fiber.Ctx) error {
+	bookObjID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Geçersiz kitap ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var book Book
+	if err := bookCollection.FindOne(ctx, bson.M{"_id": bookObjID}).Decode(&book); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kitap bulunamadı"})
+	}
+	if book.Location == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kitabın raf konumu tanımlı değil"})
+	}
+
+	var floorMap FloorMap
+	if err := floorMapCollection.FindOne(ctx, bson.M{"branch": book.Location.Branch, "floor": book.Location.Floor}).Decode(&floorMap); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Kat planı bulunamadı"})
+	}
+
+	zone, shelf := floorMap.findShelf(book.Location.Zone, book.Location.Shelf)
+	if shelf == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Raf kat planında bulunamadı"})
+	}
+
+	if c.Query("format") == "svg" {
+		svg := renderFloorMapSVG(&floorMap, zone, shelf)
+		return sendCacheable(c, []byte(svg), "image/svg+xml", time.Time{}, "public, max-age=300")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"book_id":  book.ID,
+		"title":    book.Title,
+		"location": book.Location,
+		"zone":     fiber.Map{"code": zone.Code, "name": zone.Name},
+		"position": fiber.Map{"x": shelf.X, "y": shelf.Y},
+		"map":      floorMap,
+	})
+}
+
+func renderFloorMapSVG(m *FloorMap, target *Zone, shelf *Shelf) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %g %g" width="%g" height="%g">`, m.Width, m.Height, m.Width, m.Height)
+	fmt.Fprintf(&sb, `<rect x="0" y="0" width="%g" height="%g" fill="#ffffff" stroke="#333333"/>`, m.Width, m.Height)
+
+	for i := range m.Zones {
+		z := &m.Zones[i]
+		fill := "#eeeeee"
+		if z == target {
+			fill = "#ffe08a"
+		}
+		fmt.Fprintf(&sb, `<rect x="%g" y="%g" width="%g" height="%g" fill="%s" stroke="#999999"/>`, z.X, z.Y, z.Width, z.Height, fill)
+		fmt.Fprintf(&sb, `<text x="%g" y="%g" font-size="12" fill="#333333">%s</text>`, z.X+4, z.Y+14, html.EscapeString(z.Name))
+		for _, s := range z.Shelves {
+			fmt.Fprintf(&sb, `<circle cx="%g" cy="%g" r="3" fill="#999999"/>`, s.X, s.Y)
+		}
+	}
+
+	fmt.Fprintf(&sb, `<circle cx="%g" cy="%g" r="8" fill="#d62828"/>`, shelf.X, shelf.Y)
+	sb.WriteString(`</svg>`)
+	return sb.String()
+}